@@ -2,6 +2,7 @@ package upcloud
 
 import (
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
@@ -14,6 +15,10 @@ type Artifact struct {
 	driver    internal.Driver
 	Templates []*upcloud.Storage
 
+	// files holds paths of local files produced by the build,
+	// e.g. the 'output_manifest' document
+	files []string
+
 	// StateData should store data such as GeneratedData
 	// to be shared with post-processors
 	StateData map[string]interface{}
@@ -24,7 +29,10 @@ func (*Artifact) BuilderId() string {
 }
 
 func (a *Artifact) Files() []string {
-	return []string{}
+	if a.files == nil {
+		return []string{}
+	}
+	return a.files
 }
 
 func (a *Artifact) Id() string {
@@ -50,5 +58,11 @@ func (a *Artifact) Destroy() error {
 			return err
 		}
 	}
+
+	for _, f := range a.files {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
 	return nil
 }
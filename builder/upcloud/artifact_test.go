@@ -42,3 +42,17 @@ func TestArtifact_String(t *testing.T) {
 		t.Errorf("Expected: %q, got: %q", expected, result)
 	}
 }
+
+func TestArtifact_Files(t *testing.T) {
+	a := &Artifact{}
+	if len(a.Files()) != 0 {
+		t.Errorf("Expected no files, got: %v", a.Files())
+	}
+
+	a = &Artifact{files: []string{"manifest.json"}}
+	result := a.Files()
+
+	if len(result) != 1 || result[0] != "manifest.json" {
+		t.Errorf("Expected: %v, got: %v", []string{"manifest.json"}, result)
+	}
+}
@@ -3,6 +3,7 @@ package upcloud
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
 	internal "github.com/UpCloudLtd/upcloud-packer/internal"
@@ -30,25 +31,71 @@ func (b *Builder) Prepare(raws ...interface{}) (generatedVars []string, warnings
 		return nil, warnings, errs
 	}
 
+	if b.config.ValidateOnline {
+		if errs := b.validateOnline(); errs != nil {
+			return nil, warnings, errs
+		}
+	}
+
 	buildGeneratedData := []string{
 		"ServerUUID",
 		"ServerTitle",
 		"ServerSize",
+		"ServerIP",
+		"SourceStorageUUID",
+		"SourceStorageTitle",
 		"TemplateUUID",
 		"TemplateTitle",
 		"TemplateSize",
+		"Zone",
+		"BuildTimestamp",
+		"NetworkUUID",
+		"FloatingIP",
+	}
+
+	// per-zone template variables, e.g. TemplateUUID_nl_ams1
+	zones := append([]string{b.config.Zone}, b.config.CloneZones...)
+	for _, zone := range zones {
+		for _, name := range []string{"TemplateUUID", "TemplateTitle", "TemplateSize"} {
+			buildGeneratedData = append(buildGeneratedData, internal.ZoneVariableName(name, zone))
+		}
+	}
+	return buildGeneratedData, warnings, nil
+}
+
+func (b *Builder) driverConfig() *internal.DriverConfig {
+	return &internal.DriverConfig{
+		Username:              b.config.Username,
+		Password:              b.config.Password,
+		Timeout:               b.config.Timeout,
+		ServerCreateTimeout:   b.config.ServerCreateTimeout,
+		ServerStopTimeout:     b.config.ServerStopTimeout,
+		TemplateCreateTimeout: b.config.TemplateCreateTimeout,
+		CloneTimeout:          b.config.CloneTimeout,
+		ServerStopType:        b.config.ServerStopType,
+		SSHUsername:           b.config.Comm.SSHUsername,
+	}
+}
+
+// validateOnline checks the configuration against the API when 'validate_online' is set
+func (b *Builder) validateOnline() error {
+	driver := internal.NewDriver(b.driverConfig())
+	es := driver.ValidateOnline(&internal.OnlineValidationOpts{
+		Zones:       append([]string{b.config.Zone}, b.config.CloneZones...),
+		Plan:        internal.DefaultPlan,
+		StorageSize: b.config.StorageSize,
+		Storage:     b.config.storageFilter(),
+		CDROM:       b.config.CDROM,
+	})
+	if len(es) == 0 {
+		return nil
 	}
-	return buildGeneratedData, nil, nil
+	return packersdk.MultiErrorAppend(nil, es...)
 }
 
 func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook) (packersdk.Artifact, error) {
 	// Setup the state bag and initial state for the steps
-	b.driver = internal.NewDriver(&internal.DriverConfig{
-		Username:    b.config.Username,
-		Password:    b.config.Password,
-		Timeout:     b.config.Timeout,
-		SSHUsername: b.config.Comm.SSHUsername,
-	})
+	b.driver = internal.NewDriver(b.driverConfig())
 
 	state := new(multistep.BasicStateBag)
 	state.Put("config", &b.config)
@@ -57,31 +104,75 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 	state.Put("driver", b.driver)
 
 	generatedData := &packerbuilderdata.GeneratedData{State: state}
+	generatedData.Put("Zone", b.config.Zone)
+	generatedData.Put("BuildTimestamp", time.Now().UTC().Format(time.RFC3339))
+
+	debugKeyPath := fmt.Sprintf("ssh_key-%s.pem", b.config.PackerBuildName)
+
+	// the floating IP step reconnects through the same connect step
+	stepConnect := &communicator.StepConnect{
+		Config:    &b.config.Comm,
+		Host:      internal.SshHostCallback,
+		SSHConfig: b.config.Comm.SSHConfigFunc(),
+	}
 
 	// Build the steps
 	steps := []multistep.Step{
 		&StepCreateSSHKey{
 			Debug:        b.config.PackerDebug,
-			DebugKeyPath: fmt.Sprintf("ssh_key-%s.pem", b.config.PackerBuildName),
+			DebugKeyPath: debugKeyPath,
+		},
+		&StepPreflightCheck{
+			Config: &b.config,
+		},
+		&StepCreateNetwork{
+			Config:        &b.config,
+			GeneratedData: generatedData,
+		},
+		&StepCreateBastion{
+			Config: &b.config,
 		},
 		&StepCreateServer{
 			Config:        &b.config,
 			GeneratedData: generatedData,
+			DebugKeyPath:  debugKeyPath,
+		},
+		&StepAttachFloatingIP{
+			Config:        &b.config,
+			GeneratedData: generatedData,
+		},
+		&StepCreateFirewall{
+			Config: &b.config,
 		},
-		&communicator.StepConnect{
-			Config:    &b.config.Comm,
-			Host:      internal.SshHostCallback,
-			SSHConfig: b.config.Comm.SSHConfigFunc(),
+		stepConnect,
+		&StepConfigureFloatingIP{
+			Config:  &b.config,
+			Connect: stepConnect,
+		},
+		&StepWaitCloudInit{
+			Config: &b.config,
 		},
 		&commonsteps.StepProvision{},
 		&commonsteps.StepCleanupTempKeys{
 			Comm: &b.config.Comm,
 		},
-		&StepTeardownServer{},
+		&StepSysprep{
+			Config: &b.config,
+		},
+		&StepEjectCDROM{
+			Config: &b.config,
+		},
+		&StepTeardownServer{
+			Config: &b.config,
+		},
+		&StepRemoveFirewall{},
 		&StepCreateTemplate{
 			Config:        &b.config,
 			GeneratedData: generatedData,
 		},
+		&StepOutputManifest{
+			Config: &b.config,
+		},
 	}
 
 	// Run
@@ -98,13 +189,21 @@ func (b *Builder) Run(ctx context.Context, ui packersdk.Ui, hook packersdk.Hook)
 		return nil, fmt.Errorf("No template found in state, the build was probably cancelled")
 	}
 
+	files := []string{}
+	if manifestPath, ok := state.GetOk("manifest_path"); ok {
+		files = append(files, manifestPath.(string))
+	}
+
 	artifact := &Artifact{
 		Templates: templates.([]*upcloud.Storage),
+		files:     files,
 		config:    &b.config,
 		driver:    b.driver,
 		StateData: map[string]interface{}{
 			"generated_data":  state.Get("generated_data"),
 			"template_prefix": b.config.TemplatePrefix,
+			// true when every template is encrypted at rest
+			"storage_encrypted": state.Get("storage_encrypted"),
 		},
 	}
 	return artifact, nil
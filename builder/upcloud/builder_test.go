@@ -0,0 +1,55 @@
+package upcloud
+
+import (
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func testConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"username":     "user",
+		"password":     "pass",
+		"zone":         "nl-ams1",
+		"storage_uuid": "01000000-0000-4000-8000-000030200200",
+	}
+}
+
+func TestBuilder_impl(t *testing.T) {
+	var _ packersdk.Builder = new(Builder)
+}
+
+func TestBuilder_Prepare_generatedData(t *testing.T) {
+	config := testConfig()
+	config["clone_zones"] = []string{"fi-hel1"}
+
+	var b Builder
+	generatedVars, _, err := b.Prepare(config)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := []string{
+		"ServerUUID",
+		"ServerIP",
+		"SourceStorageUUID",
+		"TemplateUUID",
+		"Zone",
+		"BuildTimestamp",
+		"TemplateUUID_nl_ams1",
+		"TemplateTitle_fi_hel1",
+		"TemplateSize_fi_hel1",
+	}
+	for _, name := range expected {
+		found := false
+		for _, v := range generatedVars {
+			if v == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("Expected generated variable %q in %v", name, generatedVars)
+		}
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
@@ -13,8 +16,11 @@ import (
 	"github.com/hashicorp/packer-plugin-sdk/common"
 	"github.com/hashicorp/packer-plugin-sdk/communicator"
 	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/random"
+	"github.com/hashicorp/packer-plugin-sdk/shutdowncommand"
 	"github.com/hashicorp/packer-plugin-sdk/template/config"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"github.com/mitchellh/mapstructure"
 )
 
 const (
@@ -22,9 +28,43 @@ const (
 	DefaultSSHUsername    = "root"
 	DefaultStorageSize    = 25
 	DefaultTimeout        = 5 * time.Minute
+	DefaultKeepServerTTL  = 24 * time.Hour
+
+	DefaultTemporaryKeyPairType = "rsa"
+
+	DefaultTemporaryNetworkCIDR = "172.16.0.0/24"
+	DefaultBastionStorageName   = "Ubuntu Server"
+
+	DefaultWinRMUsername  = "Administrator"
+	DefaultSysprepCommand = `C:\Windows\System32\Sysprep\sysprep.exe /generalize /oobe /quit /quiet`
+
+	// DefaultWinRMUserData enables a WinRM HTTPS listener with a self-signed certificate with cloudbase-init,
+	// it is removed with DefaultWinRMCleanupScript before the template is created
+	DefaultWinRMUserData = `#ps1_sysnative
+Set-Service -Name WinRM -StartupType Automatic
+Start-Service -Name WinRM
+winrm set winrm/config/service/auth '@{Basic="true"}'
+$cert = New-SelfSignedCertificate -DnsName packer-winrm -CertStoreLocation Cert:\LocalMachine\My
+New-Item -Path WSMan:\localhost\Listener -Transport HTTPS -Address * -CertificateThumbPrint $cert.Thumbprint -Force
+netsh advfirewall firewall add rule name="Packer WinRM HTTPS" dir=in action=allow protocol=TCP localport=5986
+`
+
+	// DefaultWinRMCleanupScript removes the firewall rule, certificate and listener of DefaultWinRMUserData.
+	// The listener is removed last as it carries the connection running the script.
+	DefaultWinRMCleanupScript = `netsh advfirewall firewall delete rule name="Packer WinRM HTTPS"
+Get-ChildItem Cert:\LocalMachine\My | Where-Object { $_.Subject -eq 'CN=packer-winrm' } | Remove-Item
+winrm set winrm/config/service/auth '@{Basic="false"}'
+winrm delete winrm/config/Listener?Address=*+Transport=HTTPS
+`
+
+	MinStorageSize = 10
+	MaxStorageSize = 4096
 )
 
 var (
+	uuidRegexp = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	zoneRegexp = regexp.MustCompile(`^[a-z]{2}-[a-z]{3}[0-9]+$`)
+
 	DefaultNetworking = []request.CreateServerInterface{
 		{
 			IPAddresses: []request.CreateServerIPAddress{
@@ -41,6 +81,8 @@ type Config struct {
 	common.PackerConfig `mapstructure:",squash"`
 	Comm                communicator.Config `mapstructure:",squash"`
 
+	shutdowncommand.ShutdownConfig `mapstructure:",squash"`
+
 	// Required configuration values
 	Username    string `mapstructure:"username"`
 	Password    string `mapstructure:"password"`
@@ -49,26 +91,92 @@ type Config struct {
 	StorageName string `mapstructure:"storage_name"`
 
 	// Optional configuration values
+	StorageNameMatch  string `mapstructure:"storage_name_match"`
+	StorageMostRecent bool   `mapstructure:"storage_most_recent"`
+	StorageAccess     string `mapstructure:"storage_access"`
+	StorageType       string `mapstructure:"storage_type"`
+
 	TemplatePrefix string        `mapstructure:"template_prefix"`
+	TemplateName   string        `mapstructure:"template_name"`
 	StorageSize    int           `mapstructure:"storage_size"`
 	Timeout        time.Duration `mapstructure:"state_timeout_duration"`
 	CloneZones     []string      `mapstructure:"clone_zones"`
+	OutputManifest string        `mapstructure:"output_manifest"`
+
+	ServerCreateTimeout   time.Duration `mapstructure:"server_create_timeout"`
+	ServerStopTimeout     time.Duration `mapstructure:"server_stop_timeout"`
+	TemplateCreateTimeout time.Duration `mapstructure:"template_create_timeout"`
+	CloneTimeout          time.Duration `mapstructure:"clone_timeout"`
+	ServerStopType        string        `mapstructure:"server_stop_type"`
+
+	ValidateOnline      bool          `mapstructure:"validate_online"`
+	SkipPreflightCheck  bool          `mapstructure:"skip_preflight_check"`
+	KeepServerOnFailure bool          `mapstructure:"keep_server_on_failure"`
+	KeepServerTTL       time.Duration `mapstructure:"keep_server_ttl"`
+
+	ServerLabels   map[string]string `mapstructure:"server_labels"`
+	TemplateLabels map[string]string `mapstructure:"template_labels"`
+
+	TemporaryNetwork        bool   `mapstructure:"temporary_network"`
+	TemporaryNetworkCIDR    string `mapstructure:"temporary_network_cidr"`
+	TemporaryNetworkGateway bool   `mapstructure:"temporary_network_gateway"`
+
+	TemporaryFirewall    bool     `mapstructure:"temporary_firewall"`
+	FirewallAllowedCIDRs []string `mapstructure:"firewall_allowed_cidrs"`
+
+	AutoBastion        bool   `mapstructure:"auto_bastion"`
+	BastionStorageUUID string `mapstructure:"bastion_storage_uuid"`
+
+	UserData         string        `mapstructure:"user_data"`
+	UserDataFile     string        `mapstructure:"user_data_file"`
+	Metadata         bool          `mapstructure:"metadata"`
+	CloudInitWait    bool          `mapstructure:"cloud_init_wait"`
+	CloudInitTimeout time.Duration `mapstructure:"cloud_init_timeout"`
+
+	WindowsSysprep bool   `mapstructure:"windows_sysprep"`
+	SysprepCommand string `mapstructure:"sysprep_command"`
+
+	NICModel       string `mapstructure:"nic_model"`
+	VideoModel     string `mapstructure:"video_model"`
+	Timezone       string `mapstructure:"timezone"`
+	BootOrder      string `mapstructure:"boot_order"`
+	Host           int    `mapstructure:"host"`
+	StorageAddress string `mapstructure:"storage_address"`
+	CDROM          string `mapstructure:"cdrom"`
+
+	StorageEncryption bool `mapstructure:"storage_encryption"`
+
+	FloatingIP          string `mapstructure:"floating_ip"`
+	TemporaryFloatingIP bool   `mapstructure:"temporary_floating_ip"`
 
 	RawNetworking []internal.NetworkInterface `mapstructure:"network_interfaces"`
 	Networking    []request.CreateServerInterface
 
+	SSHInterface        string `mapstructure:"ssh_interface"`
+	SSHInterfaceNetwork string `mapstructure:"ssh_interface_network"`
+
 	SSHPrivateKeyPath string `mapstructure:"ssh_private_key_path"`
 	SSHPublicKeyPath  string `mapstructure:"ssh_public_key_path"`
 	SSHPrivateKey     []byte
 	SSHPublicKey      []byte
 
+	// winRMBootstrap is set when the server is bootstrapped with DefaultWinRMUserData
+	winRMBootstrap bool
+
 	ctx interpolate.Context
 }
 
 func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
+	var md mapstructure.Metadata
 	err := config.Decode(c, &config.DecodeOpts{
+		Metadata:           &md,
 		Interpolate:        true,
 		InterpolateContext: &c.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			Exclude: []string{
+				"template_name",
+			},
+		},
 	}, raws...)
 
 	if err != nil {
@@ -82,6 +190,14 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 		c.TemplatePrefix = DefaultTemplatePrefix
 	}
 
+	if c.StorageNameMatch == "" {
+		c.StorageNameMatch = internal.StorageNameMatchContains
+	}
+
+	if c.StorageType == "" {
+		c.StorageType = upcloud.StorageTypeTemplate
+	}
+
 	if c.StorageSize == 0 {
 		c.StorageSize = DefaultStorageSize
 	}
@@ -90,22 +206,92 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 		c.Timeout = DefaultTimeout
 	}
 
+	for _, t := range []*time.Duration{&c.ServerCreateTimeout, &c.ServerStopTimeout, &c.TemplateCreateTimeout, &c.CloneTimeout, &c.CloudInitTimeout} {
+		if *t == 0 {
+			*t = c.Timeout
+		}
+	}
+
+	if c.KeepServerTTL == 0 {
+		c.KeepServerTTL = DefaultKeepServerTTL
+	}
+
+	if c.ServerStopType == "" {
+		c.ServerStopType = upcloud.StopTypeSoft
+	}
+
+	if c.TemporaryNetworkCIDR == "" {
+		c.TemporaryNetworkCIDR = DefaultTemporaryNetworkCIDR
+	}
+
+	if c.SSHInterface == "" {
+		if c.TemporaryNetwork && len(c.RawNetworking) == 0 {
+			c.SSHInterface = internal.SSHInterfacePrivate
+		} else {
+			c.SSHInterface = internal.SSHInterfacePublicIPv4
+		}
+	}
+
 	if c.Comm.SSHUsername == "" {
 		c.Comm.SSHUsername = DefaultSSHUsername
 	}
 
+	if c.Comm.SSHTemporaryKeyPairType == "" {
+		c.Comm.SSHTemporaryKeyPairType = DefaultTemporaryKeyPairType
+	}
+
+	if c.Comm.Type == "winrm" {
+		if c.Comm.WinRMUser == "" {
+			c.Comm.WinRMUser = DefaultWinRMUsername
+		}
+		// the bootstrap script only enables the HTTPS listener
+		if c.UserData == "" && c.UserDataFile == "" {
+			c.UserData = DefaultWinRMUserData
+			c.winRMBootstrap = true
+			if !isSet(md, "winrm_use_ssl") {
+				c.Comm.WinRMUseSSL = true
+			}
+			if !isSet(md, "winrm_insecure") {
+				c.Comm.WinRMInsecure = true
+			}
+		}
+	}
+
+	if c.SysprepCommand == "" {
+		c.SysprepCommand = DefaultSysprepCommand
+	}
+
 	if len(c.RawNetworking) == 0 {
-		c.Networking = DefaultNetworking
+		// builds in a temporary network have no public interface by default
+		if c.TemporaryNetwork {
+			c.Networking = []request.CreateServerInterface{}
+		} else {
+			c.Networking = DefaultNetworking
+		}
 	} else {
 		c.Networking = internal.ConvertNetworkTypes(c.RawNetworking)
 	}
 
 	// validate
 	var errs *packer.MultiError
+	warnings := []string{}
 	if es := c.Comm.Prepare(&c.ctx); len(es) > 0 {
 		errs = packer.MultiErrorAppend(errs, es...)
 	}
 
+	if es := c.ShutdownConfig.Prepare(&c.ctx); len(es) > 0 {
+		errs = packer.MultiErrorAppend(errs, es...)
+	}
+
+	if c.ShutdownCommand != "" && c.Comm.Type == "none" {
+		errs = packer.MultiErrorAppend(errs, errors.New("'shutdown_command' requires a communicator"))
+	}
+
+	if c.ServerStopType != upcloud.StopTypeSoft && c.ServerStopType != upcloud.StopTypeHard {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("'server_stop_type' must be %q or %q", upcloud.StopTypeSoft, upcloud.StopTypeHard))
+	}
+
 	if c.Username == "" {
 		errs = packer.MultiErrorAppend(
 			errs, errors.New("'username' must be specified"),
@@ -124,12 +310,174 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 		)
 	}
 
+	if c.Zone != "" && !zoneRegexp.MatchString(c.Zone) {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("'zone' %q is not a valid zone name, e.g. \"nl-ams1\"", c.Zone))
+	}
+
+	for _, zone := range c.CloneZones {
+		switch {
+		case !zoneRegexp.MatchString(zone):
+			errs = packer.MultiErrorAppend(
+				errs, fmt.Errorf("'clone_zones' entry %q is not a valid zone name, e.g. \"nl-ams1\"", zone))
+		case zone == c.Zone:
+			warnings = append(warnings, fmt.Sprintf("'clone_zones' contains the build zone %q, the template is already created there", zone))
+		}
+	}
+
 	if c.StorageUUID == "" && c.StorageName == "" {
 		errs = packer.MultiErrorAppend(
 			errs, errors.New("'storage_uuid' or 'storage_name' must be specified"),
 		)
 	}
 
+	if c.StorageUUID != "" && !uuidRegexp.MatchString(c.StorageUUID) {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("'storage_uuid' %q is not a valid UUID", c.StorageUUID))
+	}
+
+	if c.CDROM != "" && !uuidRegexp.MatchString(c.CDROM) {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("'cdrom' %q is not a valid UUID", c.CDROM))
+	}
+
+	if c.StorageUUID != "" && c.StorageName != "" {
+		warnings = append(warnings, "Both 'storage_uuid' and 'storage_name' are set, 'storage_name' is ignored")
+	}
+
+	if c.StorageSize < MinStorageSize || c.StorageSize > MaxStorageSize {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("'storage_size' must be between %d and %d GB", MinStorageSize, MaxStorageSize))
+	}
+
+	for _, cidr := range c.FirewallAllowedCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			errs = packer.MultiErrorAppend(
+				errs, fmt.Errorf("'firewall_allowed_cidrs' entry %q is not a valid CIDR", cidr))
+		}
+	}
+
+	if len(c.FirewallAllowedCIDRs) > 0 && !c.TemporaryFirewall {
+		warnings = append(warnings, "'firewall_allowed_cidrs' is ignored without 'temporary_firewall'")
+	}
+
+	if c.AutoBastion {
+		if c.Comm.Type != "ssh" {
+			errs = packer.MultiErrorAppend(errs, errors.New("'auto_bastion' requires the ssh communicator"))
+		}
+		if c.SSHInterface != internal.SSHInterfacePrivate {
+			errs = packer.MultiErrorAppend(
+				errs, fmt.Errorf("'auto_bastion' requires 'ssh_interface' %q", internal.SSHInterfacePrivate))
+		}
+		if c.Comm.SSHBastionHost != "" {
+			errs = packer.MultiErrorAppend(errs, errors.New("'auto_bastion' and 'ssh_bastion_host' can't be used together"))
+		}
+		if c.BastionStorageUUID != "" && !uuidRegexp.MatchString(c.BastionStorageUUID) {
+			errs = packer.MultiErrorAppend(
+				errs, fmt.Errorf("'bastion_storage_uuid' %q is not a valid UUID", c.BastionStorageUUID))
+		}
+	}
+
+	if es := c.validateNetworking(); len(es) > 0 {
+		errs = packer.MultiErrorAppend(errs, es...)
+	}
+
+	if es := c.validateFloatingIP(); len(es) > 0 {
+		errs = packer.MultiErrorAppend(errs, es...)
+	}
+
+	if es := c.validateHardware(); len(es) > 0 {
+		errs = packer.MultiErrorAppend(errs, es...)
+	}
+
+	switch c.StorageNameMatch {
+	case internal.StorageNameMatchExact, internal.StorageNameMatchContains:
+	case internal.StorageNameMatchRegex:
+		if _, err := regexp.Compile(c.StorageName); err != nil {
+			errs = packer.MultiErrorAppend(
+				errs, fmt.Errorf("Failed to parse 'storage_name' regex: %s", err))
+		}
+	default:
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("'storage_name_match' must be one of %q, %q or %q",
+				internal.StorageNameMatchExact, internal.StorageNameMatchContains, internal.StorageNameMatchRegex))
+	}
+
+	switch c.StorageAccess {
+	case "", upcloud.StorageAccessPublic, upcloud.StorageAccessPrivate:
+	default:
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("'storage_access' must be %q or %q", upcloud.StorageAccessPublic, upcloud.StorageAccessPrivate))
+	}
+
+	switch c.StorageType {
+	case upcloud.StorageTypeTemplate, upcloud.StorageTypeNormal, upcloud.StorageTypeBackup:
+	default:
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("'storage_type' must be one of %q, %q or %q",
+				upcloud.StorageTypeTemplate, upcloud.StorageTypeNormal, upcloud.StorageTypeBackup))
+	}
+
+	if c.TemplateName != "" {
+		if err := interpolate.Validate(c.TemplateName, &c.ctx); err != nil {
+			errs = packer.MultiErrorAppend(
+				errs, fmt.Errorf("Failed to parse 'template_name': %s", err))
+		}
+	}
+
+	if c.UserData != "" && c.UserDataFile != "" {
+		errs = packer.MultiErrorAppend(errs, errors.New("Only one of 'user_data' or 'user_data_file' can be specified"))
+	}
+
+	if c.UserDataFile != "" {
+		userData, err := ioutil.ReadFile(c.UserDataFile)
+		if err != nil {
+			errs = packer.MultiErrorAppend(
+				errs, fmt.Errorf("Failed to read user data file: %s", err))
+		}
+		c.UserData = string(userData)
+	}
+
+	// cloud-init reads user data from the metadata service
+	if c.UserData != "" {
+		c.Metadata = true
+	}
+
+	if c.winRMBootstrap && !c.Comm.WinRMUseSSL {
+		warnings = append(warnings, "The default WinRM bootstrap only enables the HTTPS listener, 'winrm_use_ssl' must be true unless 'user_data' is set")
+	}
+
+	if c.WindowsSysprep && c.Comm.Type != "winrm" {
+		errs = packer.MultiErrorAppend(errs, errors.New("'windows_sysprep' requires the winrm communicator"))
+	}
+
+	if c.CloudInitWait && c.Comm.Type != "ssh" {
+		errs = packer.MultiErrorAppend(errs, errors.New("'cloud_init_wait' requires the ssh communicator"))
+	}
+
+	switch c.Comm.SSHTemporaryKeyPairType {
+	case "rsa":
+		if c.Comm.SSHTemporaryKeyPairBits != 0 && c.Comm.SSHTemporaryKeyPairBits < 2048 {
+			errs = packer.MultiErrorAppend(errs, errors.New("'temporary_key_pair_bits' must be at least 2048 for rsa keys"))
+		}
+	case "ecdsa":
+		switch c.Comm.SSHTemporaryKeyPairBits {
+		case 0, 256, 384, 521:
+		default:
+			errs = packer.MultiErrorAppend(errs, errors.New("'temporary_key_pair_bits' must be 256, 384 or 521 for ecdsa keys"))
+		}
+	case "ed25519":
+		if c.Comm.SSHTemporaryKeyPairBits != 0 {
+			warnings = append(warnings, "'temporary_key_pair_bits' is ignored for ed25519 keys")
+		}
+	default:
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("'temporary_key_pair_type' must be one of rsa, ecdsa or ed25519, got %q", c.Comm.SSHTemporaryKeyPairType))
+	}
+
+	if (c.SSHPrivateKeyPath == "") != (c.SSHPublicKeyPath == "") {
+		warnings = append(warnings, "Only one of 'ssh_private_key_path' and 'ssh_public_key_path' is set, a temporary key pair is used instead")
+	}
+
 	if c.SSHPrivateKeyPath != "" {
 		c.SSHPrivateKey, err = ioutil.ReadFile(c.SSHPrivateKeyPath)
 		if err != nil {
@@ -147,10 +495,238 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 	}
 
 	if errs != nil && len(errs.Errors) > 0 {
-		return nil, errs
+		return warnings, errs
+	}
+
+	return warnings, nil
+}
+
+// validateNetworking checks the network interfaces and that the communicator can reach the server
+func (c *Config) validateNetworking() []error {
+	errs := []error{}
+	reachable := false
+	for i, iface := range c.Networking {
+		switch iface.Type {
+		case upcloud.IPAddressAccessPublic, upcloud.IPAddressAccessUtility:
+		case upcloud.IPAddressAccessPrivate:
+			if iface.Network == "" {
+				errs = append(errs, fmt.Errorf("'network_interfaces' %d: private interface must have a 'network'", i))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("'network_interfaces' %d: 'type' must be one of %q, %q or %q",
+				i, upcloud.IPAddressAccessPublic, upcloud.IPAddressAccessPrivate, upcloud.IPAddressAccessUtility))
+		}
+
+		if iface.Network != "" && !uuidRegexp.MatchString(iface.Network) {
+			errs = append(errs, fmt.Errorf("'network_interfaces' %d: 'network' %q is not a valid UUID", i, iface.Network))
+		}
+
+		if len(iface.IPAddresses) == 0 {
+			errs = append(errs, fmt.Errorf("'network_interfaces' %d: at least one IP address must be specified", i))
+		}
+
+		for _, ip := range iface.IPAddresses {
+			switch ip.Family {
+			case upcloud.IPAddressFamilyIPv4, upcloud.IPAddressFamilyIPv6:
+				address := internal.ServerAddress{Access: iface.Type, Family: ip.Family, Network: iface.Network}
+				if address.Matches(c.SSHInterface, c.SSHInterfaceNetwork) {
+					reachable = true
+				}
+			default:
+				errs = append(errs, fmt.Errorf("'network_interfaces' %d: IP address 'family' must be %q or %q",
+					i, upcloud.IPAddressFamilyIPv4, upcloud.IPAddressFamilyIPv6))
+			}
+		}
 	}
 
-	return nil, nil
+	if c.TemporaryNetwork {
+		if _, _, err := net.ParseCIDR(c.TemporaryNetworkCIDR); err != nil {
+			errs = append(errs, fmt.Errorf("'temporary_network_cidr' %q is not a valid CIDR", c.TemporaryNetworkCIDR))
+		}
+
+		// the temporary network is attached as the first private interface
+		address := internal.ServerAddress{Access: upcloud.IPAddressAccessPrivate, Family: upcloud.IPAddressFamilyIPv4}
+		if address.Matches(c.SSHInterface, c.SSHInterfaceNetwork) {
+			reachable = true
+		}
+	} else if c.TemporaryNetworkGateway {
+		errs = append(errs, errors.New("'temporary_network_gateway' requires 'temporary_network'"))
+	}
+
+	switch c.SSHInterface {
+	case internal.SSHInterfacePublicIPv4, internal.SSHInterfacePublicIPv6, internal.SSHInterfaceUtility, internal.SSHInterfacePrivate:
+		if !reachable && c.Comm.Type != "none" {
+			errs = append(errs, fmt.Errorf("'network_interfaces' must contain an interface matching 'ssh_interface' %q for the communicator", c.SSHInterface))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("'ssh_interface' must be one of %q, %q, %q or %q",
+			internal.SSHInterfacePublicIPv4, internal.SSHInterfacePublicIPv6, internal.SSHInterfaceUtility, internal.SSHInterfacePrivate))
+	}
+
+	if c.SSHInterfaceNetwork != "" {
+		if c.SSHInterface != internal.SSHInterfacePrivate {
+			errs = append(errs, fmt.Errorf("'ssh_interface_network' can only be used with 'ssh_interface' %q", internal.SSHInterfacePrivate))
+		} else if !uuidRegexp.MatchString(c.SSHInterfaceNetwork) {
+			errs = append(errs, fmt.Errorf("'ssh_interface_network' %q is not a valid UUID", c.SSHInterfaceNetwork))
+		}
+	}
+	return errs
+}
+
+// validateFloatingIP checks that the floating IP can be attached to a public IPv4 interface
+// and configured over the communicator
+func (c *Config) validateFloatingIP() []error {
+	errs := []error{}
+	if c.FloatingIP == "" && !c.TemporaryFloatingIP {
+		return errs
+	}
+
+	if c.FloatingIP != "" && c.TemporaryFloatingIP {
+		errs = append(errs, errors.New("only one of 'floating_ip' or 'temporary_floating_ip' can be specified"))
+	}
+
+	if ip := net.ParseIP(c.FloatingIP); c.FloatingIP != "" && (ip == nil || ip.To4() == nil) {
+		errs = append(errs, fmt.Errorf("'floating_ip' %q is not a valid IPv4 address", c.FloatingIP))
+	}
+
+	if c.Comm.Type != "ssh" {
+		errs = append(errs, errors.New("floating IPs require the ssh communicator"))
+	}
+
+	public := false
+	for _, iface := range c.Networking {
+		if iface.Type != upcloud.IPAddressAccessPublic {
+			continue
+		}
+		for _, ip := range iface.IPAddresses {
+			if ip.Family == upcloud.IPAddressFamilyIPv4 {
+				public = true
+			}
+		}
+	}
+	if !public {
+		errs = append(errs, errors.New("floating IPs require a public IPv4 interface in 'network_interfaces'"))
+	}
+
+	return errs
+}
+
+// validateHardware checks the virtual hardware options of the build server
+func (c *Config) validateHardware() []error {
+	errs := []error{}
+
+	switch c.NICModel {
+	case "", internal.NICModelE1000, internal.NICModelVirtio, internal.NICModelRTL8139:
+	default:
+		errs = append(errs, fmt.Errorf("'nic_model' must be one of %s, %s or %s",
+			internal.NICModelE1000, internal.NICModelVirtio, internal.NICModelRTL8139))
+	}
+
+	switch c.VideoModel {
+	case "", upcloud.VideoModelVGA, upcloud.VideoModelCirrus:
+	default:
+		errs = append(errs, fmt.Errorf("'video_model' must be %q or %q", upcloud.VideoModelVGA, upcloud.VideoModelCirrus))
+	}
+
+	switch c.StorageAddress {
+	case "", internal.StorageAddressVirtio, internal.StorageAddressSCSI, internal.StorageAddressIDE:
+	default:
+		errs = append(errs, fmt.Errorf("'storage_address' must be one of %s, %s or %s",
+			internal.StorageAddressVirtio, internal.StorageAddressSCSI, internal.StorageAddressIDE))
+	}
+
+	if c.BootOrder != "" {
+		for _, device := range strings.Split(c.BootOrder, ",") {
+			if device != "disk" && device != "cdrom" && device != "network" {
+				errs = append(errs, fmt.Errorf("'boot_order' must be a comma separated list of disk, cdrom and network, got %q", c.BootOrder))
+				break
+			}
+		}
+	}
+
+	if c.Host < 0 {
+		errs = append(errs, errors.New("'host' must be a positive number"))
+	}
+
+	return errs
+}
+
+// renderTemplateName interpolates 'template_name' for a template in the given zone.
+// Build variables are available with the 'build' function, in addition to
+// {{ .Zone }}, {{ .Timestamp }} and {{ .Random }}
+func (c *Config) renderTemplateName(zone string, data map[string]interface{}) (string, error) {
+	ctxData := map[string]interface{}{}
+	for k, v := range data {
+		ctxData[k] = v
+	}
+	ctxData["Zone"] = zone
+	if _, ok := ctxData["Timestamp"]; !ok {
+		ctxData["Timestamp"] = time.Now().UTC().Format("20060102-150405")
+	}
+	if _, ok := ctxData["Random"]; !ok {
+		ctxData["Random"] = random.AlphaNumLower(8)
+	}
+
+	ctx := c.ctx
+	ctx.Data = ctxData
+	return interpolate.Render(c.TemplateName, &ctx)
+}
+
+// loginUser returns the user created on the server, the driver defaults to the SSH username
+func (c *Config) loginUser() string {
+	if c.Comm.Type == "winrm" {
+		return c.Comm.WinRMUser
+	}
+	return ""
+}
+
+// isSet reports whether the option was given in the configuration
+func isSet(md mapstructure.Metadata, key string) bool {
+	for _, k := range md.Keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// sudoPrefix returns the prefix of commands the builder runs as root on the server,
+// users other than root need passwordless sudo
+func (c *Config) sudoPrefix() string {
+	if c.Comm.SSHUsername == "root" {
+		return ""
+	}
+	return "sudo "
+}
+
+// storageFilter returns the lookup of the source storage
+func (c *Config) storageFilter() *internal.StorageFilter {
+	return &internal.StorageFilter{
+		UUID:       c.StorageUUID,
+		Name:       c.StorageName,
+		Type:       c.StorageType,
+		NameMatch:  c.StorageNameMatch,
+		Access:     c.StorageAccess,
+		MostRecent: c.StorageMostRecent,
+	}
+}
+
+// labels returns the default labels of resources created by the builder merged with the given user defined labels
+func (c *Config) labels(userLabels map[string]string, sourceStorageUuid string) map[string]string {
+	labels := map[string]string{
+		internal.LabelBuilder:   internal.LabelBuilderValue,
+		internal.LabelCreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if c.PackerBuildName != "" {
+		labels["packer-build-name"] = c.PackerBuildName
+	}
+	if sourceStorageUuid != "" {
+		labels["source-storage"] = sourceStorageUuid
+	}
+	for k, v := range userLabels {
+		labels[k] = v
+	}
+	return labels
 }
 
 // get params from environment
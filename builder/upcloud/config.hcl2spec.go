@@ -65,15 +65,60 @@ type FlatConfig struct {
 	WinRMUseSSL               *bool             `mapstructure:"winrm_use_ssl" cty:"winrm_use_ssl" hcl:"winrm_use_ssl"`
 	WinRMInsecure             *bool             `mapstructure:"winrm_insecure" cty:"winrm_insecure" hcl:"winrm_insecure"`
 	WinRMUseNTLM              *bool             `mapstructure:"winrm_use_ntlm" cty:"winrm_use_ntlm" hcl:"winrm_use_ntlm"`
+	ShutdownCommand           *string           `mapstructure:"shutdown_command" required:"false" cty:"shutdown_command" hcl:"shutdown_command"`
+	ShutdownTimeout           *string           `mapstructure:"shutdown_timeout" required:"false" cty:"shutdown_timeout" hcl:"shutdown_timeout"`
 	Username                  *string           `mapstructure:"username" cty:"username"`
 	Password                  *string           `mapstructure:"password" cty:"password"`
 	Zone                      *string           `mapstructure:"zone" cty:"zone"`
 	StorageUUID               *string           `mapstructure:"storage_uuid" cty:"storage_uuid"`
 	StorageName               *string           `mapstructure:"storage_name" cty:"storage_name"`
+	StorageNameMatch          *string           `mapstructure:"storage_name_match" cty:"storage_name_match"`
+	StorageMostRecent         *bool             `mapstructure:"storage_most_recent" cty:"storage_most_recent"`
+	StorageAccess             *string           `mapstructure:"storage_access" cty:"storage_access"`
+	StorageType               *string           `mapstructure:"storage_type" cty:"storage_type"`
 	TemplatePrefix            *string           `mapstructure:"template_prefix" cty:"template_prefix"`
+	TemplateName              *string           `mapstructure:"template_name" cty:"template_name"`
 	StorageSize               *int              `mapstructure:"storage_size" cty:"storage_size"`
 	Timeout                   *string           `mapstructure:"state_timeout_duration" cty:"state_timeout_duration"`
 	CloneZones                []string          `mapstructure:"clone_zones" cty:"clone_zones"`
+	OutputManifest            *string           `mapstructure:"output_manifest" cty:"output_manifest"`
+	ServerCreateTimeout       *string           `mapstructure:"server_create_timeout" cty:"server_create_timeout"`
+	ServerStopTimeout         *string           `mapstructure:"server_stop_timeout" cty:"server_stop_timeout"`
+	TemplateCreateTimeout     *string           `mapstructure:"template_create_timeout" cty:"template_create_timeout"`
+	CloneTimeout              *string           `mapstructure:"clone_timeout" cty:"clone_timeout"`
+	ServerStopType            *string           `mapstructure:"server_stop_type" cty:"server_stop_type"`
+	ValidateOnline            *bool             `mapstructure:"validate_online" cty:"validate_online"`
+	SkipPreflightCheck        *bool             `mapstructure:"skip_preflight_check" cty:"skip_preflight_check"`
+	KeepServerOnFailure       *bool             `mapstructure:"keep_server_on_failure" cty:"keep_server_on_failure"`
+	KeepServerTTL             *string           `mapstructure:"keep_server_ttl" cty:"keep_server_ttl"`
+	ServerLabels              map[string]string `mapstructure:"server_labels" cty:"server_labels"`
+	TemplateLabels            map[string]string `mapstructure:"template_labels" cty:"template_labels"`
+	UserData                  *string           `mapstructure:"user_data" cty:"user_data"`
+	UserDataFile              *string           `mapstructure:"user_data_file" cty:"user_data_file"`
+	Metadata                  *bool             `mapstructure:"metadata" cty:"metadata"`
+	CloudInitWait             *bool             `mapstructure:"cloud_init_wait" cty:"cloud_init_wait"`
+	CloudInitTimeout          *string           `mapstructure:"cloud_init_timeout" cty:"cloud_init_timeout"`
+	WindowsSysprep            *bool             `mapstructure:"windows_sysprep" cty:"windows_sysprep"`
+	SysprepCommand            *string           `mapstructure:"sysprep_command" cty:"sysprep_command"`
+	NICModel                  *string           `mapstructure:"nic_model" cty:"nic_model"`
+	VideoModel                *string           `mapstructure:"video_model" cty:"video_model"`
+	Timezone                  *string           `mapstructure:"timezone" cty:"timezone"`
+	BootOrder                 *string           `mapstructure:"boot_order" cty:"boot_order"`
+	Host                      *int              `mapstructure:"host" cty:"host"`
+	StorageAddress            *string           `mapstructure:"storage_address" cty:"storage_address"`
+	CDROM                     *string           `mapstructure:"cdrom" cty:"cdrom"`
+	StorageEncryption         *bool             `mapstructure:"storage_encryption" cty:"storage_encryption"`
+	FloatingIP                *string           `mapstructure:"floating_ip" cty:"floating_ip"`
+	TemporaryFloatingIP       *bool             `mapstructure:"temporary_floating_ip" cty:"temporary_floating_ip"`
+	TemporaryNetwork          *bool             `mapstructure:"temporary_network" cty:"temporary_network"`
+	TemporaryNetworkCIDR      *string           `mapstructure:"temporary_network_cidr" cty:"temporary_network_cidr"`
+	TemporaryNetworkGateway   *bool             `mapstructure:"temporary_network_gateway" cty:"temporary_network_gateway"`
+	TemporaryFirewall         *bool             `mapstructure:"temporary_firewall" cty:"temporary_firewall"`
+	FirewallAllowedCIDRs      []string          `mapstructure:"firewall_allowed_cidrs" cty:"firewall_allowed_cidrs"`
+	AutoBastion               *bool             `mapstructure:"auto_bastion" cty:"auto_bastion"`
+	BastionStorageUUID        *string           `mapstructure:"bastion_storage_uuid" cty:"bastion_storage_uuid"`
+	SSHInterface              *string           `mapstructure:"ssh_interface" cty:"ssh_interface"`
+	SSHInterfaceNetwork       *string           `mapstructure:"ssh_interface_network" cty:"ssh_interface_network"`
 	SSHPrivateKeyPath         *string           `mapstructure:"ssh_private_key_path" cty:"ssh_private_key_path"`
 	SSHPublicKeyPath          *string           `mapstructure:"ssh_public_key_path" cty:"ssh_public_key_path"`
 }
@@ -147,15 +192,60 @@ func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
 		"winrm_use_ssl":                &hcldec.AttrSpec{Name: "winrm_use_ssl", Type: cty.Bool, Required: false},
 		"winrm_insecure":               &hcldec.AttrSpec{Name: "winrm_insecure", Type: cty.Bool, Required: false},
 		"winrm_use_ntlm":               &hcldec.AttrSpec{Name: "winrm_use_ntlm", Type: cty.Bool, Required: false},
+		"shutdown_command":             &hcldec.AttrSpec{Name: "shutdown_command", Type: cty.String, Required: false},
+		"shutdown_timeout":             &hcldec.AttrSpec{Name: "shutdown_timeout", Type: cty.String, Required: false},
 		"username":                     &hcldec.AttrSpec{Name: "username", Type: cty.String, Required: false},
 		"password":                     &hcldec.AttrSpec{Name: "password", Type: cty.String, Required: false},
 		"zone":                         &hcldec.AttrSpec{Name: "zone", Type: cty.String, Required: true},
 		"storage_uuid":                 &hcldec.AttrSpec{Name: "storage_uuid", Type: cty.String, Required: false},
 		"storage_name":                 &hcldec.AttrSpec{Name: "storage_name", Type: cty.String, Required: false},
+		"storage_name_match":           &hcldec.AttrSpec{Name: "storage_name_match", Type: cty.String, Required: false},
+		"storage_most_recent":          &hcldec.AttrSpec{Name: "storage_most_recent", Type: cty.Bool, Required: false},
+		"storage_access":               &hcldec.AttrSpec{Name: "storage_access", Type: cty.String, Required: false},
+		"storage_type":                 &hcldec.AttrSpec{Name: "storage_type", Type: cty.String, Required: false},
 		"template_prefix":              &hcldec.AttrSpec{Name: "template_prefix", Type: cty.String, Required: false},
+		"template_name":                &hcldec.AttrSpec{Name: "template_name", Type: cty.String, Required: false},
 		"storage_size":                 &hcldec.AttrSpec{Name: "storage_size", Type: cty.Number, Required: false},
 		"state_timeout_duration":       &hcldec.AttrSpec{Name: "state_timeout_duration", Type: cty.String, Required: false},
 		"clone_zones":                  &hcldec.AttrSpec{Name: "clone_zones", Type: cty.List(cty.String), Required: false},
+		"output_manifest":              &hcldec.AttrSpec{Name: "output_manifest", Type: cty.String, Required: false},
+		"server_create_timeout":        &hcldec.AttrSpec{Name: "server_create_timeout", Type: cty.String, Required: false},
+		"server_stop_timeout":          &hcldec.AttrSpec{Name: "server_stop_timeout", Type: cty.String, Required: false},
+		"template_create_timeout":      &hcldec.AttrSpec{Name: "template_create_timeout", Type: cty.String, Required: false},
+		"clone_timeout":                &hcldec.AttrSpec{Name: "clone_timeout", Type: cty.String, Required: false},
+		"server_stop_type":             &hcldec.AttrSpec{Name: "server_stop_type", Type: cty.String, Required: false},
+		"validate_online":              &hcldec.AttrSpec{Name: "validate_online", Type: cty.Bool, Required: false},
+		"skip_preflight_check":         &hcldec.AttrSpec{Name: "skip_preflight_check", Type: cty.Bool, Required: false},
+		"keep_server_on_failure":       &hcldec.AttrSpec{Name: "keep_server_on_failure", Type: cty.Bool, Required: false},
+		"keep_server_ttl":              &hcldec.AttrSpec{Name: "keep_server_ttl", Type: cty.String, Required: false},
+		"server_labels":                &hcldec.AttrSpec{Name: "server_labels", Type: cty.Map(cty.String), Required: false},
+		"template_labels":              &hcldec.AttrSpec{Name: "template_labels", Type: cty.Map(cty.String), Required: false},
+		"user_data":                    &hcldec.AttrSpec{Name: "user_data", Type: cty.String, Required: false},
+		"user_data_file":               &hcldec.AttrSpec{Name: "user_data_file", Type: cty.String, Required: false},
+		"metadata":                     &hcldec.AttrSpec{Name: "metadata", Type: cty.Bool, Required: false},
+		"cloud_init_wait":              &hcldec.AttrSpec{Name: "cloud_init_wait", Type: cty.Bool, Required: false},
+		"cloud_init_timeout":           &hcldec.AttrSpec{Name: "cloud_init_timeout", Type: cty.String, Required: false},
+		"windows_sysprep":              &hcldec.AttrSpec{Name: "windows_sysprep", Type: cty.Bool, Required: false},
+		"sysprep_command":              &hcldec.AttrSpec{Name: "sysprep_command", Type: cty.String, Required: false},
+		"nic_model":                    &hcldec.AttrSpec{Name: "nic_model", Type: cty.String, Required: false},
+		"video_model":                  &hcldec.AttrSpec{Name: "video_model", Type: cty.String, Required: false},
+		"timezone":                     &hcldec.AttrSpec{Name: "timezone", Type: cty.String, Required: false},
+		"boot_order":                   &hcldec.AttrSpec{Name: "boot_order", Type: cty.String, Required: false},
+		"host":                         &hcldec.AttrSpec{Name: "host", Type: cty.Number, Required: false},
+		"storage_address":              &hcldec.AttrSpec{Name: "storage_address", Type: cty.String, Required: false},
+		"cdrom":                        &hcldec.AttrSpec{Name: "cdrom", Type: cty.String, Required: false},
+		"storage_encryption":           &hcldec.AttrSpec{Name: "storage_encryption", Type: cty.Bool, Required: false},
+		"floating_ip":                  &hcldec.AttrSpec{Name: "floating_ip", Type: cty.String, Required: false},
+		"temporary_floating_ip":        &hcldec.AttrSpec{Name: "temporary_floating_ip", Type: cty.Bool, Required: false},
+		"temporary_network":            &hcldec.AttrSpec{Name: "temporary_network", Type: cty.Bool, Required: false},
+		"temporary_network_cidr":       &hcldec.AttrSpec{Name: "temporary_network_cidr", Type: cty.String, Required: false},
+		"temporary_network_gateway":    &hcldec.AttrSpec{Name: "temporary_network_gateway", Type: cty.Bool, Required: false},
+		"temporary_firewall":           &hcldec.AttrSpec{Name: "temporary_firewall", Type: cty.Bool, Required: false},
+		"firewall_allowed_cidrs":       &hcldec.AttrSpec{Name: "firewall_allowed_cidrs", Type: cty.List(cty.String), Required: false},
+		"auto_bastion":                 &hcldec.AttrSpec{Name: "auto_bastion", Type: cty.Bool, Required: false},
+		"bastion_storage_uuid":         &hcldec.AttrSpec{Name: "bastion_storage_uuid", Type: cty.String, Required: false},
+		"ssh_interface":                &hcldec.AttrSpec{Name: "ssh_interface", Type: cty.String, Required: false},
+		"ssh_interface_network":        &hcldec.AttrSpec{Name: "ssh_interface_network", Type: cty.String, Required: false},
 		"ssh_private_key_path":         &hcldec.AttrSpec{Name: "ssh_private_key_path", Type: cty.String, Required: false},
 		"ssh_public_key_path":          &hcldec.AttrSpec{Name: "ssh_public_key_path", Type: cty.String, Required: false},
 	}
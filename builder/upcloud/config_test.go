@@ -0,0 +1,363 @@
+package upcloud
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfig_Prepare_templateName(t *testing.T) {
+	raw := testConfig()
+	raw["template_name"] = "app-{{ user `version` }}-{{ .Zone }}-{{ .Timestamp }}-{{ .Random }}"
+	raw["packer_user_variables"] = map[string]string{"version": "1.2.3"}
+
+	var c Config
+	if _, err := c.Prepare(raw); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	title, err := c.renderTemplateName("fi-hel1", map[string]interface{}{
+		"Timestamp": "20210206-213858",
+		"Random":    "abcd1234",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := "app-1.2.3-fi-hel1-20210206-213858-abcd1234"
+	if title != expected {
+		t.Errorf("Expected: %q, got: %q", expected, title)
+	}
+}
+
+func TestConfig_Prepare_templateNameBuildVariable(t *testing.T) {
+	raw := testConfig()
+	raw["template_name"] = "app-{{ build `SourceStorageTitle` }}"
+
+	var c Config
+	if _, err := c.Prepare(raw); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	title, err := c.renderTemplateName("nl-ams1", map[string]interface{}{
+		"SourceStorageTitle": "ubuntu",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if title != "app-ubuntu" {
+		t.Errorf("Expected: %q, got: %q", "app-ubuntu", title)
+	}
+}
+
+func TestConfig_labels(t *testing.T) {
+	raw := testConfig()
+	raw["packer_build_name"] = "test-build"
+	raw["server_labels"] = map[string]string{
+		"team":           "finance",
+		"packer-builder": "custom",
+	}
+
+	var c Config
+	if _, err := c.Prepare(raw); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	labels := c.labels(c.ServerLabels, "source-uuid")
+	expected := map[string]string{
+		"packer-build-name": "test-build",
+		"packer-builder":    "custom",
+		"source-storage":    "source-uuid",
+		"team":              "finance",
+	}
+
+	if len(labels) != len(expected)+1 {
+		t.Errorf("Expected: %v and creation time, got: %v", expected, labels)
+	}
+	if _, err := time.Parse(time.RFC3339, labels["packer-created-at"]); err != nil {
+		t.Errorf("Expected creation time label, got: %v", labels)
+	}
+	for k, v := range expected {
+		if labels[k] != v {
+			t.Errorf("Expected label %q to be %q, got: %q", k, v, labels[k])
+		}
+	}
+}
+
+func TestConfig_Prepare_timeouts(t *testing.T) {
+	raw := testConfig()
+	raw["state_timeout_duration"] = "10m"
+	raw["clone_timeout"] = "1h"
+
+	var c Config
+	if _, err := c.Prepare(raw); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if c.CloneTimeout != time.Hour {
+		t.Errorf("Expected clone timeout %s, got: %s", time.Hour, c.CloneTimeout)
+	}
+	for _, timeout := range []time.Duration{c.ServerCreateTimeout, c.ServerStopTimeout, c.TemplateCreateTimeout} {
+		if timeout != 10*time.Minute {
+			t.Errorf("Expected timeout %s, got: %s", 10*time.Minute, timeout)
+		}
+	}
+}
+
+func TestConfig_Prepare_shutdown(t *testing.T) {
+	raw := testConfig()
+	raw["shutdown_command"] = "shutdown -P now"
+
+	var c Config
+	if _, err := c.Prepare(raw); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if c.ShutdownTimeout != 5*time.Minute {
+		t.Errorf("Expected shutdown timeout %s, got: %s", 5*time.Minute, c.ShutdownTimeout)
+	}
+	if c.ServerStopType != "soft" {
+		t.Errorf("Expected server stop type %q, got: %q", "soft", c.ServerStopType)
+	}
+}
+
+func TestConfig_Prepare_validValues(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"utility ssh_interface": {
+			"ssh_interface": "utility",
+			"network_interfaces": []map[string]interface{}{
+				{"type": "utility", "ip_addresses": []map[string]string{{"family": "IPv4"}}},
+			},
+		},
+		"auto_bastion":       {"temporary_network": true, "auto_bastion": true},
+		"temporary_firewall": {"temporary_firewall": true},
+		"floating_ip":        {"floating_ip": "198.51.100.7"},
+		"rsa key bits":       {"temporary_key_pair_type": "rsa", "temporary_key_pair_bits": 4096},
+		"ecdsa key":          {"temporary_key_pair_type": "ecdsa"},
+		"ecdsa key bits":     {"temporary_key_pair_type": "ecdsa", "temporary_key_pair_bits": 384},
+		"ed25519 key":        {"temporary_key_pair_type": "ed25519"},
+		"windows_sysprep":    {"communicator": "winrm", "windows_sysprep": true},
+		"storage_name_match": {"storage_name": "ubuntu", "storage_name_match": "regex"},
+	}
+
+	for name, values := range tests {
+		t.Run(name, func(t *testing.T) {
+			raw := testConfig()
+			for k, v := range values {
+				raw[k] = v
+			}
+
+			var c Config
+			if _, err := c.Prepare(raw); err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestConfig_Prepare_invalidValues(t *testing.T) {
+	publicIPv4 := []map[string]string{{"family": "IPv4"}}
+
+	tests := []struct {
+		name     string
+		values   map[string]interface{}
+		expected string
+	}{
+		{"zone", map[string]interface{}{"zone": "Amsterdam"}, "zone"},
+		{"clone_zones", map[string]interface{}{"clone_zones": []string{"fi-hel1", "helsinki"}}, "clone_zones"},
+		{"storage_uuid", map[string]interface{}{"storage_uuid": "not-a-uuid"}, "storage_uuid"},
+		{"storage_size", map[string]interface{}{"storage_size": 5}, "storage_size"},
+		{"storage_name_match", map[string]interface{}{"storage_name_match": "fuzzy"}, "storage_name_match"},
+		{"storage_name regex", map[string]interface{}{"storage_name": "ubuntu (", "storage_name_match": "regex"}, "regex"},
+		{"template_name", map[string]interface{}{"template_name": "app-{{ .Zone "}, "template_name"},
+		{"nic_model", map[string]interface{}{"nic_model": "ne2k_pci"}, "nic_model"},
+		{"video_model", map[string]interface{}{"video_model": "qxl"}, "video_model"},
+		{"boot_order", map[string]interface{}{"boot_order": "disk,floppy"}, "boot_order"},
+		{"storage_address", map[string]interface{}{"storage_address": "sata"}, "storage_address"},
+		{"host", map[string]interface{}{"host": -1}, "host"},
+		{"cdrom", map[string]interface{}{"cdrom": "virtio-win.iso"}, "cdrom"},
+		{"windows_sysprep", map[string]interface{}{"windows_sysprep": true}, "windows_sysprep"},
+		{"firewall_allowed_cidrs", map[string]interface{}{"temporary_firewall": true, "firewall_allowed_cidrs": []string{"203.0.113.7"}}, "firewall_allowed_cidrs"},
+		{"shutdown_command", map[string]interface{}{"shutdown_command": "shutdown -P now", "communicator": "none"}, "shutdown_command"},
+		{"server_stop_type", map[string]interface{}{"shutdown_command": "shutdown -P now", "server_stop_type": "graceful"}, "server_stop_type"},
+		{"user_data", map[string]interface{}{"user_data": "#!/bin/sh", "user_data_file": os.DevNull}, "user_data"},
+		{"temporary_network_cidr", map[string]interface{}{"temporary_network": true, "temporary_network_cidr": "172.16.0.0"}, "temporary_network_cidr"},
+		{
+			"auto_bastion",
+			map[string]interface{}{
+				"temporary_network":  true,
+				"auto_bastion":       true,
+				"ssh_interface":      "public_ipv4",
+				"network_interfaces": []map[string]interface{}{{"type": "public", "ip_addresses": publicIPv4}},
+			},
+			"auto_bastion",
+		},
+		{
+			"ssh_interface",
+			map[string]interface{}{
+				"ssh_interface":      "public_ipv6",
+				"network_interfaces": []map[string]interface{}{{"type": "utility", "ip_addresses": publicIPv4}},
+			},
+			"ssh_interface",
+		},
+		{
+			"network_interfaces type",
+			map[string]interface{}{"network_interfaces": []map[string]interface{}{
+				{"type": "public", "ip_addresses": publicIPv4},
+				{"type": "internal", "ip_addresses": publicIPv4},
+			}},
+			"'type' must be one of",
+		},
+		{
+			"network_interfaces family",
+			map[string]interface{}{"network_interfaces": []map[string]interface{}{
+				{"type": "public", "ip_addresses": []map[string]string{{"family": "IPv4"}, {"family": "ipv5"}}},
+			}},
+			"'family' must be",
+		},
+		{
+			"network_interfaces private without network",
+			map[string]interface{}{"network_interfaces": []map[string]interface{}{
+				{"type": "public", "ip_addresses": publicIPv4},
+				{"type": "private", "ip_addresses": publicIPv4},
+			}},
+			"must have a 'network'",
+		},
+		{
+			"network_interfaces unreachable",
+			map[string]interface{}{"network_interfaces": []map[string]interface{}{
+				{"type": "utility", "ip_addresses": publicIPv4},
+			}},
+			"matching 'ssh_interface'",
+		},
+		{"rsa key bits", map[string]interface{}{"temporary_key_pair_type": "rsa", "temporary_key_pair_bits": 1024}, "temporary_key_pair_bits"},
+		{"ecdsa key bits", map[string]interface{}{"temporary_key_pair_type": "ecdsa", "temporary_key_pair_bits": 2048}, "temporary_key_pair_bits"},
+		{"temporary_key_pair_type", map[string]interface{}{"temporary_key_pair_type": "dsa"}, "temporary_key_pair_type"},
+		{"floating_ip address", map[string]interface{}{"floating_ip": "2001:db8::7"}, "floating_ip"},
+		{"floating_ip both options", map[string]interface{}{"floating_ip": "198.51.100.7", "temporary_floating_ip": true}, "floating_ip"},
+		{"temporary_floating_ip winrm", map[string]interface{}{"temporary_floating_ip": true, "communicator": "winrm"}, "floating"},
+		{"temporary_floating_ip private only", map[string]interface{}{"temporary_floating_ip": true, "temporary_network": true}, "floating"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			raw := testConfig()
+			for k, v := range test.values {
+				raw[k] = v
+			}
+
+			var c Config
+			_, err := c.Prepare(raw)
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("Expected error containing %q, got: %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestConfig_Prepare_warnings(t *testing.T) {
+	raw := testConfig()
+	raw["storage_name"] = "ubuntu"
+	raw["ssh_public_key_path"] = "/dev/null"
+
+	var c Config
+	warnings, err := c.Prepare(raw)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(warnings) != 2 {
+		t.Errorf("Expected 2 warnings, got: %v", warnings)
+	}
+}
+
+func TestConfig_Prepare_temporaryNetwork(t *testing.T) {
+	raw := testConfig()
+	raw["temporary_network"] = true
+
+	var c Config
+	if _, err := c.Prepare(raw); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(c.Networking) != 0 {
+		t.Errorf("Expected no default interfaces, got: %v", c.Networking)
+	}
+	if c.SSHInterface != "private" {
+		t.Errorf("Expected ssh_interface %q, got: %q", "private", c.SSHInterface)
+	}
+}
+
+func TestConfig_Prepare_userData(t *testing.T) {
+	f, err := ioutil.TempFile("", "user-data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("#cloud-config\n")
+	f.Close()
+
+	raw := testConfig()
+	raw["user_data_file"] = f.Name()
+
+	var c Config
+	if _, err := c.Prepare(raw); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if c.UserData != "#cloud-config\n" {
+		t.Errorf("Unexpected user data: %q", c.UserData)
+	}
+	if !c.Metadata {
+		t.Error("Expected metadata to be enabled with user data")
+	}
+}
+
+func TestConfig_Prepare_winRM(t *testing.T) {
+	raw := testConfig()
+	raw["communicator"] = "winrm"
+	raw["windows_sysprep"] = true
+
+	var c Config
+	if _, err := c.Prepare(raw); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if c.Comm.WinRMUser != DefaultWinRMUsername {
+		t.Errorf("Expected WinRM user %q, got: %q", DefaultWinRMUsername, c.Comm.WinRMUser)
+	}
+	if c.UserData != DefaultWinRMUserData || !c.Metadata {
+		t.Errorf("Expected WinRM bootstrap user data with metadata, got: %q, %t", c.UserData, c.Metadata)
+	}
+	if c.loginUser() != DefaultWinRMUsername {
+		t.Errorf("Expected login user %q, got: %q", DefaultWinRMUsername, c.loginUser())
+	}
+	if c.SysprepCommand != DefaultSysprepCommand {
+		t.Errorf("Expected sysprep command %q, got: %q", DefaultSysprepCommand, c.SysprepCommand)
+	}
+	if !c.Comm.WinRMUseSSL || !c.Comm.WinRMInsecure || c.Comm.WinRMPort != 5986 {
+		t.Errorf("Expected WinRM over HTTPS on port 5986, got: %t, %t, %d", c.Comm.WinRMUseSSL, c.Comm.WinRMInsecure, c.Comm.WinRMPort)
+	}
+
+	// user values are kept
+	raw["winrm_insecure"] = false
+	c = Config{}
+	if _, err := c.Prepare(raw); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !c.Comm.WinRMUseSSL || c.Comm.WinRMInsecure {
+		t.Errorf("Expected 'winrm_insecure' false to be kept, got: %t, %t", c.Comm.WinRMUseSSL, c.Comm.WinRMInsecure)
+	}
+}
+
+func TestConfig_Prepare_temporaryKeyPair(t *testing.T) {
+	var c Config
+	if _, err := c.Prepare(testConfig()); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	// bits are left to the default of the key type
+	if c.Comm.SSHTemporaryKeyPairType != DefaultTemporaryKeyPairType || c.Comm.SSHTemporaryKeyPairBits != 0 {
+		t.Errorf("Expected %s key pair with default size, got: %s %d",
+			DefaultTemporaryKeyPairType, c.Comm.SSHTemporaryKeyPairType, c.Comm.SSHTemporaryKeyPairBits)
+	}
+}
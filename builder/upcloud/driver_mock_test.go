@@ -0,0 +1,225 @@
+package upcloud
+
+import (
+	"time"
+
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
+	internal "github.com/UpCloudLtd/upcloud-packer/internal"
+)
+
+// MockDriver is a driver for step tests, it records the calls and returns the configured values
+type MockDriver struct {
+	Calls []string
+
+	Storage      *upcloud.Storage
+	ClonedUuid   string
+	StoragePrice float64
+
+	CreateServerOpts *internal.ServerOpts
+	ServerDetails    *internal.ServerDetails
+
+	AccountResources *internal.AccountResources
+	PriceZone        *upcloud.PriceZone
+
+	ServerStorageUuid   string
+	StorageEncrypted    bool
+	SetStorageLabelsErr error
+
+	CloneStorageSource    string
+	CloneStorageZone      string
+	CloneStorageEncrypted bool
+	DeletedTemplates      []string
+	DeletedServers        []string
+	// AttachedStorages are deleted with the server, like DeleteServerAndStorages does
+	AttachedStorages []string
+	DeletedStorages  []string
+	DetachedCDROMs   []string
+}
+
+var _ internal.Driver = &MockDriver{}
+
+func (d *MockDriver) call(name string) {
+	d.Calls = append(d.Calls, name)
+}
+
+func (d *MockDriver) CreateServer(opts *internal.ServerOpts) (*internal.ServerDetails, error) {
+	d.call("CreateServer")
+	d.CreateServerOpts = opts
+	d.AttachedStorages = append(d.AttachedStorages, opts.StorageUuid)
+	if opts.CDROMUuid != "" {
+		d.AttachedStorages = append(d.AttachedStorages, opts.CDROMUuid)
+	}
+	return d.ServerDetails, nil
+}
+
+func (d *MockDriver) DeleteServer(serverUuid string) error {
+	d.call("DeleteServer")
+	d.DeletedServers = append(d.DeletedServers, serverUuid)
+	d.DeletedStorages = append(d.DeletedStorages, d.AttachedStorages...)
+	d.AttachedStorages = nil
+	return nil
+}
+
+func (d *MockDriver) StopServer(string) error {
+	d.call("StopServer")
+	return nil
+}
+
+func (d *MockDriver) EjectCDROM(string) error {
+	d.call("EjectCDROM")
+	return nil
+}
+
+func (d *MockDriver) DetachCDROM(string) error {
+	d.call("DetachCDROM")
+	attached := []string{}
+	for _, uuid := range d.AttachedStorages {
+		if d.CreateServerOpts != nil && uuid == d.CreateServerOpts.CDROMUuid {
+			d.DetachedCDROMs = append(d.DetachedCDROMs, uuid)
+			continue
+		}
+		attached = append(attached, uuid)
+	}
+	d.AttachedStorages = attached
+	return nil
+}
+
+func (d *MockDriver) WaitServerStopped(string, time.Duration) error {
+	d.call("WaitServerStopped")
+	return nil
+}
+
+func (d *MockDriver) GetStorage(*internal.StorageFilter) (*upcloud.Storage, error) {
+	d.call("GetStorage")
+	return d.Storage, nil
+}
+
+func (d *MockDriver) GetServerStorage(string) (*upcloud.ServerStorageDevice, error) {
+	d.call("GetServerStorage")
+	return &upcloud.ServerStorageDevice{UUID: d.ServerStorageUuid}, nil
+}
+
+func (d *MockDriver) CloneStorage(storageUuid, zone, title string, encrypted bool) (*upcloud.Storage, error) {
+	d.call("CloneStorage")
+	d.CloneStorageSource = storageUuid
+	d.CloneStorageZone = zone
+	d.CloneStorageEncrypted = encrypted
+	return &upcloud.Storage{UUID: d.ClonedUuid, Title: title, Zone: zone}, nil
+}
+
+func (d *MockDriver) IsStorageEncrypted(string) (bool, error) {
+	d.call("IsStorageEncrypted")
+	return d.StorageEncrypted, nil
+}
+
+func (d *MockDriver) CreateTemplate(storageUuid, title string) (*upcloud.Storage, error) {
+	d.call("CreateTemplate")
+	return &upcloud.Storage{UUID: "template-" + storageUuid, Title: title}, nil
+}
+
+func (d *MockDriver) DeleteTemplate(templateUuid string) error {
+	d.call("DeleteTemplate")
+	d.DeletedTemplates = append(d.DeletedTemplates, templateUuid)
+	return nil
+}
+
+func (d *MockDriver) SetStorageLabels(string, map[string]string) error {
+	d.call("SetStorageLabels")
+	return d.SetStorageLabelsErr
+}
+
+func (d *MockDriver) SetServerLabels(string, map[string]string) error {
+	d.call("SetServerLabels")
+	return nil
+}
+
+func (d *MockDriver) GetStoragePrice(string, int) (float64, error) {
+	d.call("GetStoragePrice")
+	return d.StoragePrice, nil
+}
+
+func (d *MockDriver) GetPriceZone(string) (*upcloud.PriceZone, error) {
+	d.call("GetPriceZone")
+	if d.PriceZone != nil {
+		return d.PriceZone, nil
+	}
+	return &upcloud.PriceZone{}, nil
+}
+
+func (d *MockDriver) GetAccountResources() (*internal.AccountResources, error) {
+	d.call("GetAccountResources")
+	if d.AccountResources != nil {
+		return d.AccountResources, nil
+	}
+	return &internal.AccountResources{}, nil
+}
+
+func (d *MockDriver) GetLeftovers(time.Duration, bool) ([]internal.Leftover, error) {
+	d.call("GetLeftovers")
+	return nil, nil
+}
+
+func (d *MockDriver) ValidateOnline(*internal.OnlineValidationOpts) []error {
+	d.call("ValidateOnline")
+	return nil
+}
+
+func (d *MockDriver) CreateNetwork(*internal.NetworkOpts) (*upcloud.Network, error) {
+	d.call("CreateNetwork")
+	return &upcloud.Network{}, nil
+}
+
+func (d *MockDriver) DeleteNetwork(string) error {
+	d.call("DeleteNetwork")
+	return nil
+}
+
+func (d *MockDriver) CreateRouter(string) (*upcloud.Router, error) {
+	d.call("CreateRouter")
+	return &upcloud.Router{}, nil
+}
+
+func (d *MockDriver) DeleteRouter(string) error {
+	d.call("DeleteRouter")
+	return nil
+}
+
+func (d *MockDriver) CreateNATGateway(string, string, string, map[string]string) (string, error) {
+	d.call("CreateNATGateway")
+	return "", nil
+}
+
+func (d *MockDriver) DeleteNATGateway(string) error {
+	d.call("DeleteNATGateway")
+	return nil
+}
+
+func (d *MockDriver) SetFirewallRules(string, []upcloud.FirewallRule) error {
+	d.call("SetFirewallRules")
+	return nil
+}
+
+func (d *MockDriver) DeleteFirewallRules(string) error {
+	d.call("DeleteFirewallRules")
+	return nil
+}
+
+func (d *MockDriver) CreateFloatingIP(string) (*upcloud.IPAddress, error) {
+	d.call("CreateFloatingIP")
+	return &upcloud.IPAddress{}, nil
+}
+
+func (d *MockDriver) AttachFloatingIP(_, address string) (*upcloud.IPAddress, error) {
+	d.call("AttachFloatingIP")
+	return &upcloud.IPAddress{Address: address}, nil
+}
+
+func (d *MockDriver) DetachFloatingIP(string) error {
+	d.call("DetachFloatingIP")
+	return nil
+}
+
+func (d *MockDriver) ReleaseFloatingIP(string) error {
+	d.call("ReleaseFloatingIP")
+	return nil
+}
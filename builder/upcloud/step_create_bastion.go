@@ -0,0 +1,160 @@
+package upcloud
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud/request"
+	internal "github.com/UpCloudLtd/upcloud-packer/internal"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepCreateBastion represents the step that creates a temporary public server
+// the communicator connects through to reach the build server over a private network
+type StepCreateBastion struct {
+	Config *Config
+}
+
+// Run runs the actual step
+func (s *StepCreateBastion) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	if !s.Config.AutoBastion {
+		return multistep.ActionContinue
+	}
+
+	ui := state.Get("ui").(packer.Ui)
+	driver := state.Get("driver").(internal.Driver)
+
+	networkUuid := s.bastionNetwork(state)
+	if networkUuid == "" {
+		return internal.StepHaltWithError(state, fmt.Errorf("Unable to find the private network of the build server for the bastion host"))
+	}
+
+	ui.Say("Getting bastion storage...")
+
+	storage, err := driver.GetStorage(&internal.StorageFilter{
+		UUID:       s.Config.BastionStorageUUID,
+		Name:       DefaultBastionStorageName,
+		NameMatch:  internal.StorageNameMatchContains,
+		Access:     upcloud.StorageAccessPublic,
+		MostRecent: true,
+	})
+	if err != nil {
+		return internal.StepHaltWithError(state, fmt.Errorf("Error getting bastion storage, set 'bastion_storage_uuid': %s", err))
+	}
+
+	ui.Say(fmt.Sprintf("Creating bastion server based on storage %q...", storage.Title))
+
+	response, err := driver.CreateServer(&internal.ServerOpts{
+		StorageUuid:    storage.UUID,
+		StorageSize:    MinStorageSize,
+		Zone:           s.Config.Zone,
+		TemplatePrefix: fmt.Sprintf("%s-bastion", s.Config.TemplatePrefix),
+		SshPublicKey:   state.Get("ssh_key_public").(string),
+		Networking: []request.CreateServerInterface{
+			{
+				IPAddresses: []request.CreateServerIPAddress{
+					{
+						Family: upcloud.IPAddressFamilyIPv4,
+					},
+				},
+				Type: upcloud.IPAddressAccessPublic,
+			},
+			{
+				IPAddresses: []request.CreateServerIPAddress{
+					{
+						Family: upcloud.IPAddressFamilyIPv4,
+					},
+				},
+				Type:    upcloud.IPAddressAccessPrivate,
+				Network: networkUuid,
+			},
+		},
+		Labels: s.Config.labels(s.Config.ServerLabels, ""),
+	})
+	if err != nil {
+		return internal.StepHaltWithError(state, err)
+	}
+
+	state.Put("bastion_uuid", response.UUID)
+	state.Put("bastion_title", response.Title)
+
+	bastionIp, err := internal.GetServerIp(internal.GetServerAddresses(&response.ServerDetails), internal.SSHInterfacePublicIPv4, "")
+	if err != nil {
+		return internal.StepHaltWithError(state, err)
+	}
+
+	// the bastion configuration only accepts a key file
+	keyFile, err := ioutil.TempFile("", "packer-upcloud-bastion-key")
+	if err != nil {
+		return internal.StepHaltWithError(state, fmt.Errorf("Error creating bastion key file: %s", err))
+	}
+	state.Put("bastion_key_file", keyFile.Name())
+
+	_, err = keyFile.Write(s.Config.Comm.SSHPrivateKey)
+	keyFile.Close()
+	if err != nil {
+		return internal.StepHaltWithError(state, fmt.Errorf("Error writing bastion key file: %s", err))
+	}
+
+	ui.Say(fmt.Sprintf("Bastion server %q created, connecting through %s", response.Title, bastionIp))
+
+	s.Config.Comm.SSHBastionHost = bastionIp
+	s.Config.Comm.SSHBastionPort = 22
+	s.Config.Comm.SSHBastionUsername = s.Config.Comm.SSHUsername
+	s.Config.Comm.SSHBastionPrivateKeyFile = keyFile.Name()
+
+	return multistep.ActionContinue
+}
+
+// bastionNetwork returns the private network the communicator connects to
+func (s *StepCreateBastion) bastionNetwork(state multistep.StateBag) string {
+	if s.Config.SSHInterfaceNetwork != "" {
+		return s.Config.SSHInterfaceNetwork
+	}
+	if networkUuid, ok := state.GetOk("network_uuid"); ok {
+		return networkUuid.(string)
+	}
+	for _, iface := range s.Config.Networking {
+		if iface.Type == upcloud.IPAddressAccessPrivate {
+			return iface.Network
+		}
+	}
+	return ""
+}
+
+// Cleanup deletes the bastion server unless the build server is kept for debugging
+func (s *StepCreateBastion) Cleanup(state multistep.StateBag) {
+	ui := state.Get("ui").(packer.Ui)
+	driver := state.Get("driver").(internal.Driver)
+
+	if keyFile, ok := state.GetOk("bastion_key_file"); ok {
+		os.Remove(keyFile.(string))
+	}
+
+	rawBastionUuid, ok := state.GetOk("bastion_uuid")
+	if !ok {
+		return
+	}
+	bastionUuid := rawBastionUuid.(string)
+	bastionTitle := state.Get("bastion_title").(string)
+
+	if keepServerOnFailure(s.Config, state) {
+		ui.Say(fmt.Sprintf("Keeping bastion server %q (%s) of the kept server, delete it manually when done", bastionTitle, bastionUuid))
+		return
+	}
+
+	ui.Say(fmt.Sprintf("Stopping bastion server %q...", bastionTitle))
+	if err := driver.StopServer(bastionUuid); err != nil {
+		ui.Error(err.Error())
+		return
+	}
+
+	ui.Say(fmt.Sprintf("Deleting bastion server %q...", bastionTitle))
+	if err := driver.DeleteServer(bastionUuid); err != nil {
+		ui.Error(err.Error())
+	}
+}
@@ -0,0 +1,85 @@
+package upcloud
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	internal "github.com/UpCloudLtd/upcloud-packer/internal"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepCreateFirewall represents the step that restricts access to the communicator port of the server
+type StepCreateFirewall struct {
+	Config *Config
+}
+
+// Run runs the actual step
+func (s *StepCreateFirewall) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	if !s.Config.TemporaryFirewall {
+		return multistep.ActionContinue
+	}
+
+	ui := state.Get("ui").(packer.Ui)
+	driver := state.Get("driver").(internal.Driver)
+	serverUuid := state.Get("server_uuid").(string)
+
+	cidrs := s.Config.FirewallAllowedCIDRs
+	if len(cidrs) == 0 {
+		ip, err := internal.GetPublicIP()
+		if err != nil {
+			return internal.StepHaltWithError(state, fmt.Errorf("%s, set 'firewall_allowed_cidrs' instead", err))
+		}
+		cidrs = []string{fmt.Sprintf("%s/32", ip)}
+	}
+
+	allowed := []*net.IPNet{}
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return internal.StepHaltWithError(state, fmt.Errorf("Error parsing 'firewall_allowed_cidrs': %s", err))
+		}
+		allowed = append(allowed, n)
+	}
+
+	port := s.Config.Comm.Port()
+	ui.Say(fmt.Sprintf("Creating firewall rules allowing port %d only from %s...", port, strings.Join(cidrs, ", ")))
+
+	state.Put("firewall_enabled", true)
+	if err := driver.SetFirewallRules(serverUuid, internal.FirewallRules(allowed, port)); err != nil {
+		return internal.StepHaltWithError(state, err)
+	}
+
+	return multistep.ActionContinue
+}
+
+// Cleanup cleans up after the step, the rules are deleted with the server
+func (s *StepCreateFirewall) Cleanup(state multistep.StateBag) {}
+
+// StepRemoveFirewall represents the step that removes the temporary firewall rules before the templates are created
+type StepRemoveFirewall struct{}
+
+// Run runs the actual step
+func (s *StepRemoveFirewall) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	if _, ok := state.GetOk("firewall_enabled"); !ok {
+		return multistep.ActionContinue
+	}
+
+	ui := state.Get("ui").(packer.Ui)
+	driver := state.Get("driver").(internal.Driver)
+	serverUuid := state.Get("server_uuid").(string)
+
+	ui.Say("Removing firewall rules...")
+
+	if err := driver.DeleteFirewallRules(serverUuid); err != nil {
+		return internal.StepHaltWithError(state, err)
+	}
+	state.Remove("firewall_enabled")
+
+	return multistep.ActionContinue
+}
+
+// Cleanup cleans up after the step
+func (s *StepRemoveFirewall) Cleanup(state multistep.StateBag) {}
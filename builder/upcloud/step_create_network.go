@@ -0,0 +1,103 @@
+package upcloud
+
+import (
+	"context"
+	"fmt"
+
+	internal "github.com/UpCloudLtd/upcloud-packer/internal"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/packerbuilderdata"
+)
+
+// StepCreateNetwork represents the step that creates a temporary private network for the build server
+type StepCreateNetwork struct {
+	Config        *Config
+	GeneratedData *packerbuilderdata.GeneratedData
+}
+
+// Run runs the actual step
+func (s *StepCreateNetwork) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	if !s.Config.TemporaryNetwork {
+		return multistep.ActionContinue
+	}
+
+	ui := state.Get("ui").(packer.Ui)
+	driver := state.Get("driver").(internal.Driver)
+
+	name := fmt.Sprintf("packer-%s-%s", s.Config.TemplatePrefix, internal.GetNowString())
+
+	routerUuid := ""
+	if s.Config.TemporaryNetworkGateway {
+		ui.Say(fmt.Sprintf("Creating temporary router %q...", name))
+
+		router, err := driver.CreateRouter(name)
+		if err != nil {
+			return internal.StepHaltWithError(state, err)
+		}
+		routerUuid = router.UUID
+		state.Put("router_uuid", routerUuid)
+	}
+
+	ui.Say(fmt.Sprintf("Creating temporary network %q (%s) in zone %q...", name, s.Config.TemporaryNetworkCIDR, s.Config.Zone))
+
+	network, err := driver.CreateNetwork(&internal.NetworkOpts{
+		Name:   name,
+		Zone:   s.Config.Zone,
+		CIDR:   s.Config.TemporaryNetworkCIDR,
+		Router: routerUuid,
+	})
+	if err != nil {
+		return internal.StepHaltWithError(state, err)
+	}
+	state.Put("network_uuid", network.UUID)
+	s.GeneratedData.Put("NetworkUUID", network.UUID)
+
+	if s.Config.TemporaryNetworkGateway {
+		ui.Say("Creating temporary NAT gateway for outbound traffic...")
+
+		gatewayUuid, err := driver.CreateNATGateway(name, s.Config.Zone, routerUuid, s.Config.labels(s.Config.ServerLabels, ""))
+		if gatewayUuid != "" {
+			state.Put("gateway_uuid", gatewayUuid)
+		}
+		if err != nil {
+			return internal.StepHaltWithError(state, err)
+		}
+	}
+
+	return multistep.ActionContinue
+}
+
+// Cleanup deletes the temporary network resources in reverse order of creation
+func (s *StepCreateNetwork) Cleanup(state multistep.StateBag) {
+	ui := state.Get("ui").(packer.Ui)
+	driver := state.Get("driver").(internal.Driver)
+
+	if keepServerOnFailure(s.Config, state) {
+		if networkUuid, ok := state.GetOk("network_uuid"); ok {
+			ui.Say(fmt.Sprintf("Keeping temporary network %q of the kept server, delete it manually when done", networkUuid))
+		}
+		return
+	}
+
+	if rawGatewayUuid, ok := state.GetOk("gateway_uuid"); ok {
+		ui.Say("Deleting temporary NAT gateway...")
+		if err := driver.DeleteNATGateway(rawGatewayUuid.(string)); err != nil {
+			ui.Error(err.Error())
+		}
+	}
+
+	if rawNetworkUuid, ok := state.GetOk("network_uuid"); ok {
+		ui.Say(fmt.Sprintf("Deleting temporary network %q...", rawNetworkUuid))
+		if err := driver.DeleteNetwork(rawNetworkUuid.(string)); err != nil {
+			ui.Error(err.Error())
+		}
+	}
+
+	if rawRouterUuid, ok := state.GetOk("router_uuid"); ok {
+		ui.Say(fmt.Sprintf("Deleting temporary router %q...", rawRouterUuid))
+		if err := driver.DeleteRouter(rawRouterUuid.(string)); err != nil {
+			ui.Error(err.Error())
+		}
+	}
+}
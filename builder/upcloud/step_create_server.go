@@ -3,7 +3,11 @@ package upcloud
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
+	"time"
 
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud/request"
 	internal "github.com/UpCloudLtd/upcloud-packer/internal"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	"github.com/hashicorp/packer-plugin-sdk/packer"
@@ -14,6 +18,7 @@ import (
 type StepCreateServer struct {
 	Config        *Config
 	GeneratedData *packerbuilderdata.GeneratedData
+	DebugKeyPath  string
 }
 
 // Run runs the actual step
@@ -21,55 +26,244 @@ func (s *StepCreateServer) Run(_ context.Context, state multistep.StateBag) mult
 	ui := state.Get("ui").(packer.Ui)
 	driver := state.Get("driver").(internal.Driver)
 
-	rawSshKeyPublic, ok := state.GetOk("ssh_key_public")
-	if !ok {
+	winRM := s.Config.Comm.Type == "winrm"
+
+	sshKeyPublic := ""
+	if rawSshKeyPublic, ok := state.GetOk("ssh_key_public"); ok {
+		sshKeyPublic = rawSshKeyPublic.(string)
+	} else if !winRM {
 		return internal.StepHaltWithError(state, fmt.Errorf("SSH public key is missing"))
 	}
-	sshKeyPublic := rawSshKeyPublic.(string)
 
 	ui.Say("Getting storage...")
 
-	storage, err := driver.GetStorage(s.Config.StorageUUID, s.Config.StorageName)
+	storage, err := driver.GetStorage(s.Config.storageFilter())
 	if err != nil {
 		return internal.StepHaltWithError(state, err)
 	}
 
+	if err := internal.ValidateSourceStorage(storage); err != nil {
+		return internal.StepHaltWithError(state, err)
+	}
+
+	// the server is cloned from this storage
+	sourceStorageUuid := storage.UUID
+
+	// backups can't be used directly and private storages from other zones make slow and
+	// unreliable server clones, copy them into a temporary storage in the build zone first
+	crossZone := storage.Access == upcloud.StorageAccessPrivate && storage.Zone != "" && storage.Zone != s.Config.Zone
+	if storage.Type == upcloud.StorageTypeBackup || crossZone {
+		if crossZone {
+			ui.Say(fmt.Sprintf("Storage %q is in zone %q, cloning it into a temporary storage in zone %q...",
+				storage.Title, storage.Zone, s.Config.Zone))
+			s.reportCloneCost(state, storage)
+		} else {
+			ui.Say(fmt.Sprintf("Cloning backup %q into a temporary storage in zone %q...", storage.Title, s.Config.Zone))
+		}
+
+		start := time.Now()
+		title := fmt.Sprintf("packer-%s-%s-source-disk1", s.Config.TemplatePrefix, internal.GetNowString())
+		clonedStorage, err := driver.CloneStorage(storage.UUID, s.Config.Zone, title, s.Config.StorageEncryption)
+		if err != nil {
+			return internal.StepHaltWithError(state, fmt.Errorf("Error cloning storage %q to zone %q: %s", storage.UUID, s.Config.Zone, err))
+		}
+		state.Put("source_clone_uuid", clonedStorage.UUID)
+		sourceStorageUuid = clonedStorage.UUID
+
+		ui.Say(fmt.Sprintf("Temporary storage %q created in %s", clonedStorage.UUID, time.Since(start).Round(time.Second)))
+
+		if err := driver.SetStorageLabels(clonedStorage.UUID, s.Config.labels(s.Config.ServerLabels, storage.UUID)); err != nil {
+			return internal.StepHaltWithError(state, err)
+		}
+	}
+
+	networking := s.Config.Networking
+	if networkUuid, ok := state.GetOk("network_uuid"); ok {
+		// the temporary network is the first private interface
+		networking = append([]request.CreateServerInterface{
+			{
+				IPAddresses: []request.CreateServerIPAddress{
+					{
+						Family: upcloud.IPAddressFamilyIPv4,
+					},
+				},
+				Type:    upcloud.IPAddressAccessPrivate,
+				Network: networkUuid.(string),
+			},
+		}, networking...)
+	}
+
 	ui.Say(fmt.Sprintf("Creating server based on storage %q...", storage.Title))
 
 	response, err := driver.CreateServer(&internal.ServerOpts{
-		StorageUuid:    storage.UUID,
+		StorageUuid:    sourceStorageUuid,
 		StorageSize:    s.Config.StorageSize,
 		Zone:           s.Config.Zone,
 		TemplatePrefix: s.Config.TemplatePrefix,
 		SshPublicKey:   sshKeyPublic,
-		Networking:     s.Config.Networking,
+		Networking:     networking,
+		UserData:       s.Config.UserData,
+		Metadata:       s.Config.Metadata,
+		Labels:         s.Config.labels(s.Config.ServerLabels, storage.UUID),
+		LoginUser:      s.Config.loginUser(),
+		CreatePassword: winRM,
+		NICModel:       s.Config.NICModel,
+		VideoModel:     s.Config.VideoModel,
+		Timezone:       s.Config.Timezone,
+		BootOrder:      s.Config.BootOrder,
+		Host:           s.Config.Host,
+		StorageAddress: s.Config.StorageAddress,
+		CDROMUuid:      s.Config.CDROM,
+
+		StorageEncryption: s.Config.StorageEncryption,
 	})
 	if err != nil {
 		return internal.StepHaltWithError(state, err)
 	}
 
+	if winRM {
+		if response.Password == "" {
+			return internal.StepHaltWithError(state, fmt.Errorf("Password of server %q is missing from the response", response.UUID))
+		}
+		packer.LogSecretFilter.Set(response.Password)
+		s.Config.Comm.WinRMPassword = response.Password
+	}
+
 	serverUuid := response.UUID
 	serverTitle := response.Title
-	serverIp, err := internal.GetServerIp(response)
+
+	// store the server before looking up the address so that it is cleaned up on failure
+	state.Put("server_uuid", serverUuid)
+	state.Put("server_title", serverTitle)
+	state.Put("source_storage", storage)
+
+	serverAddresses := internal.GetServerAddresses(&response.ServerDetails)
+	state.Put("server_addresses", serverAddresses)
+
+	serverIp, err := internal.GetServerIp(serverAddresses, s.Config.SSHInterface, s.Config.SSHInterfaceNetwork)
 	if err != nil {
 		return internal.StepHaltWithError(state, err)
 	}
 
 	ui.Say(fmt.Sprintf("Server %q created and in 'started' state", serverTitle))
 
-	state.Put("server_uuid", serverUuid)
-	state.Put("server_title", serverTitle)
 	state.Put("server_ip", serverIp)
 
 	s.GeneratedData.Put("ServerUUID", serverUuid)
 	s.GeneratedData.Put("ServerTitle", serverTitle)
-	s.GeneratedData.Put("ServerSize", serverIp)
+	s.GeneratedData.Put("ServerSize", response.Plan)
+	s.GeneratedData.Put("ServerIP", serverIp)
+	s.GeneratedData.Put("SourceStorageUUID", storage.UUID)
+	s.GeneratedData.Put("SourceStorageTitle", storage.Title)
 
 	return multistep.ActionContinue
 }
 
+// reportCloneCost shows the hourly price of the temporary storage, failures are not fatal
+func (s *StepCreateServer) reportCloneCost(state multistep.StateBag, storage *upcloud.Storage) {
+	ui := state.Get("ui").(packer.Ui)
+	driver := state.Get("driver").(internal.Driver)
+
+	price, err := driver.GetStoragePrice(s.Config.Zone, storage.Size)
+	if err != nil {
+		ui.Message(fmt.Sprintf("Unable to get the price of the temporary storage: %s", err))
+		return
+	}
+	ui.Message(fmt.Sprintf("The temporary %d GB storage costs %.2f cents per hour until the build ends", storage.Size, price))
+}
+
 // Cleanup stops and destroys the server if server details are found in the state
 func (s *StepCreateServer) Cleanup(state multistep.StateBag) {
+	ui := state.Get("ui").(packer.Ui)
+	driver := state.Get("driver").(internal.Driver)
+
+	if keepServerOnFailure(s.Config, state) {
+		s.keepServer(state)
+	} else {
+		s.cleanupServer(state)
+	}
+
+	// delete temporary source storage
+	if rawCloneUuid, ok := state.GetOk("source_clone_uuid"); ok {
+		cloneUuid := rawCloneUuid.(string)
+		ui.Say(fmt.Sprintf("Deleting temporary source storage %q...", cloneUuid))
+
+		if err := driver.DeleteTemplate(cloneUuid); err != nil {
+			ui.Error(err.Error())
+		}
+	}
+}
+
+// keepServer leaves the server running for debugging and labels it with its expiry time
+func (s *StepCreateServer) keepServer(state multistep.StateBag) {
+	rawServerUuid, ok := state.GetOk("server_uuid")
+
+	if !ok {
+		return
+	}
+
+	serverUuid := rawServerUuid.(string)
+	serverTitle := state.Get("server_title").(string)
+
+	ui := state.Get("ui").(packer.Ui)
+	driver := state.Get("driver").(internal.Driver)
+
+	expiresAt := time.Now().UTC().Add(s.Config.KeepServerTTL).Format(time.RFC3339)
+
+	labels := s.Config.labels(s.Config.ServerLabels, state.Get("source_storage").(*upcloud.Storage).UUID)
+	labels[internal.LabelExpiresAt] = expiresAt
+
+	if err := driver.SetServerLabels(serverUuid, labels); err != nil {
+		ui.Error(err.Error())
+	}
+
+	keyPath := s.Config.SSHPrivateKeyPath
+	if keyPath == "" {
+		keyPath = s.Config.Comm.SSHPrivateKeyFile
+	}
+	if keyPath == "" && len(s.Config.Comm.SSHPrivateKey) > 0 {
+		// the temporary key only exists in memory
+		if err := ioutil.WriteFile(s.DebugKeyPath, s.Config.Comm.SSHPrivateKey, 0600); err != nil {
+			ui.Error(fmt.Sprintf("Error saving debug key: %s", err))
+		} else {
+			keyPath = s.DebugKeyPath
+			ui.Message(fmt.Sprintf("The private key of the server is written to %q, delete it when done", keyPath))
+		}
+	}
+
+	identity := ""
+	if keyPath != "" {
+		identity = fmt.Sprintf(" -i %s", keyPath)
+	}
+
+	ui.Say(fmt.Sprintf("Keeping server %q (%s) for debugging until %s, delete it manually when done", serverTitle, serverUuid, expiresAt))
+	if serverIp, ok := state.GetOk("server_ip"); ok && s.Config.Comm.Type == "winrm" {
+		ui.Message(fmt.Sprintf("WinRM: %s:%d as %q", serverIp, s.Config.Comm.Port(), s.Config.Comm.WinRMUser))
+	} else if ok {
+		proxy := ""
+		if s.Config.Comm.SSHBastionHost != "" {
+			proxy = fmt.Sprintf(" -o ProxyCommand=\"ssh%s -W %%h:%%p %s@%s\"", identity, s.Config.Comm.SSHBastionUsername, s.Config.Comm.SSHBastionHost)
+		}
+		ui.Message(fmt.Sprintf("SSH: ssh%s%s %s@%s", identity, proxy, s.Config.Comm.SSHUsername, serverIp))
+	}
+}
+
+// keepServerOnFailure reports whether the build failed and the server and the
+// resources it depends on are kept with 'keep_server_on_failure'. Cancelled builds
+// are always cleaned up.
+func keepServerOnFailure(config *Config, state multistep.StateBag) bool {
+	if !config.KeepServerOnFailure {
+		return false
+	}
+	if _, ok := state.GetOk("server_uuid"); !ok {
+		return false
+	}
+	_, cancelled := state.GetOk(multistep.StateCancelled)
+	_, halted := state.GetOk(multistep.StateHalted)
+	return halted && !cancelled
+}
+
+func (s *StepCreateServer) cleanupServer(state multistep.StateBag) {
 	// Extract server uuid, return if no uuid has been stored
 	rawServerUuid, ok := state.GetOk("server_uuid")
 
@@ -92,6 +286,14 @@ func (s *StepCreateServer) Cleanup(state multistep.StateBag) {
 		return
 	}
 
+	// deleting the server deletes its storages, which must not include the ISO of 'cdrom'
+	if s.Config.CDROM != "" {
+		if err := driver.DetachCDROM(serverUuid); err != nil {
+			ui.Error(err.Error())
+			return
+		}
+	}
+
 	// delete server
 	ui.Say(fmt.Sprintf("Deleting server %q...", serverTitle))
 
@@ -0,0 +1,175 @@
+package upcloud
+
+import (
+	"context"
+	"testing"
+
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
+	internal "github.com/UpCloudLtd/upcloud-packer/internal"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/packerbuilderdata"
+)
+
+func TestStepCreateServer_crossZoneSource(t *testing.T) {
+	driver := &MockDriver{
+		Storage: &upcloud.Storage{
+			UUID:   "source-uuid",
+			Title:  "source",
+			Zone:   "fi-hel1",
+			Access: upcloud.StorageAccessPrivate,
+			Type:   upcloud.StorageTypeNormal,
+			State:  upcloud.StorageStateOnline,
+			Size:   25,
+		},
+		ClonedUuid: "clone-uuid",
+		ServerDetails: &internal.ServerDetails{
+			ServerDetails: upcloud.ServerDetails{
+				Server: upcloud.Server{UUID: "server-uuid", Title: "packer-test"},
+				IPAddresses: upcloud.IPAddressSlice{
+					{Access: upcloud.IPAddressAccessPublic, Family: upcloud.IPAddressFamilyIPv4, Address: "192.0.2.10"},
+				},
+			},
+		},
+	}
+
+	state := new(multistep.BasicStateBag)
+	state.Put("ui", packersdk.TestUi(t))
+	state.Put("driver", driver)
+	state.Put("ssh_key_public", "ssh-rsa AAAA")
+
+	step := &StepCreateServer{
+		Config: &Config{
+			Zone:           "nl-ams1",
+			TemplatePrefix: "test",
+			SSHInterface:   internal.SSHInterfacePublicIPv4,
+		},
+		GeneratedData: &packerbuilderdata.GeneratedData{State: state},
+	}
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("Unexpected action: %v, error: %v", action, state.Get("error"))
+	}
+
+	if driver.CloneStorageSource != "source-uuid" || driver.CloneStorageZone != "nl-ams1" {
+		t.Errorf("Expected source storage to be cloned to the build zone, got: %q to %q", driver.CloneStorageSource, driver.CloneStorageZone)
+	}
+
+	if driver.CreateServerOpts.StorageUuid != "clone-uuid" {
+		t.Errorf("Expected server to be created from the clone, got: %q", driver.CreateServerOpts.StorageUuid)
+	}
+
+	if state.Get("source_clone_uuid") != "clone-uuid" {
+		t.Errorf("Expected source_clone_uuid %q, got: %v", "clone-uuid", state.Get("source_clone_uuid"))
+	}
+
+	step.Cleanup(state)
+
+	if len(driver.DeletedServers) != 1 || driver.DeletedServers[0] != "server-uuid" {
+		t.Errorf("Expected server to be deleted, got: %v", driver.DeletedServers)
+	}
+
+	if len(driver.DeletedTemplates) != 1 || driver.DeletedTemplates[0] != "clone-uuid" {
+		t.Errorf("Expected the clone to be deleted, got: %v", driver.DeletedTemplates)
+	}
+}
+
+func TestStepCreateServer_sameZoneSource(t *testing.T) {
+	driver := &MockDriver{
+		Storage: &upcloud.Storage{
+			UUID:   "source-uuid",
+			Title:  "source",
+			Zone:   "nl-ams1",
+			Access: upcloud.StorageAccessPrivate,
+			Type:   upcloud.StorageTypeNormal,
+			State:  upcloud.StorageStateOnline,
+		},
+		ServerDetails: &internal.ServerDetails{
+			ServerDetails: upcloud.ServerDetails{
+				Server: upcloud.Server{UUID: "server-uuid", Title: "packer-test"},
+				IPAddresses: upcloud.IPAddressSlice{
+					{Access: upcloud.IPAddressAccessPublic, Family: upcloud.IPAddressFamilyIPv4, Address: "192.0.2.10"},
+				},
+			},
+		},
+	}
+
+	state := new(multistep.BasicStateBag)
+	state.Put("ui", packersdk.TestUi(t))
+	state.Put("driver", driver)
+	state.Put("ssh_key_public", "ssh-rsa AAAA")
+
+	step := &StepCreateServer{
+		Config: &Config{
+			Zone:         "nl-ams1",
+			SSHInterface: internal.SSHInterfacePublicIPv4,
+		},
+		GeneratedData: &packerbuilderdata.GeneratedData{State: state},
+	}
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("Unexpected action: %v, error: %v", action, state.Get("error"))
+	}
+	step.Cleanup(state)
+
+	for _, call := range driver.Calls {
+		if call == "CloneStorage" || call == "DeleteTemplate" {
+			t.Errorf("Unexpected %s for a storage in the build zone", call)
+		}
+	}
+}
+
+func TestStepCreateServer_failedBuildKeepsCDROM(t *testing.T) {
+	driver := &MockDriver{
+		Storage: &upcloud.Storage{
+			UUID:   "source-uuid",
+			Title:  "source",
+			Zone:   "nl-ams1",
+			Access: upcloud.StorageAccessPublic,
+			Type:   upcloud.StorageTypeTemplate,
+			State:  upcloud.StorageStateOnline,
+		},
+		ServerDetails: &internal.ServerDetails{
+			ServerDetails: upcloud.ServerDetails{
+				Server: upcloud.Server{UUID: "server-uuid", Title: "packer-test"},
+				IPAddresses: upcloud.IPAddressSlice{
+					{Access: upcloud.IPAddressAccessPublic, Family: upcloud.IPAddressFamilyIPv4, Address: "192.0.2.10"},
+				},
+			},
+		},
+	}
+
+	state := new(multistep.BasicStateBag)
+	state.Put("ui", packersdk.TestUi(t))
+	state.Put("driver", driver)
+	state.Put("ssh_key_public", "ssh-rsa AAAA")
+
+	step := &StepCreateServer{
+		Config: &Config{
+			Zone:         "nl-ams1",
+			SSHInterface: internal.SSHInterfacePublicIPv4,
+			CDROM:        "iso-uuid",
+		},
+		GeneratedData: &packerbuilderdata.GeneratedData{State: state},
+	}
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("Unexpected action: %v, error: %v", action, state.Get("error"))
+	}
+
+	// a later step fails the build
+	state.Put(multistep.StateHalted, true)
+	step.Cleanup(state)
+
+	if len(driver.DeletedServers) != 1 {
+		t.Errorf("Expected server to be deleted, got: %v", driver.DeletedServers)
+	}
+	for _, uuid := range driver.DeletedStorages {
+		if uuid == "iso-uuid" {
+			t.Errorf("Expected the ISO not to be deleted, got: %v", driver.DeletedStorages)
+		}
+	}
+	if len(driver.DetachedCDROMs) != 1 || driver.DetachedCDROMs[0] != "iso-uuid" {
+		t.Errorf("Expected the ISO to be detached, got: %v", driver.DetachedCDROMs)
+	}
+}
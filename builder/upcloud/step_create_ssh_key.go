@@ -2,18 +2,14 @@ package upcloud
 
 import (
 	"context"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"strings"
 
 	internal "github.com/UpCloudLtd/upcloud-packer/internal"
+	"github.com/hashicorp/packer-plugin-sdk/communicator/sshkey"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
-	"golang.org/x/crypto/ssh"
 )
 
 // StepCreateSSHKey represents the step that creates ssh private and public keys
@@ -27,6 +23,11 @@ func (s *StepCreateSSHKey) Run(_ context.Context, state multistep.StateBag) mult
 	ui := state.Get("ui").(packersdk.Ui)
 	config := state.Get("config").(*Config)
 
+	// Windows servers are accessed with the generated password
+	if config.Comm.Type == "winrm" {
+		return multistep.ActionContinue
+	}
+
 	if len(config.SSHPrivateKey) != 0 && len(config.SSHPublicKey) != 0 {
 		ui.Say("Using provided SSH keys...")
 
@@ -37,34 +38,24 @@ func (s *StepCreateSSHKey) Run(_ context.Context, state multistep.StateBag) mult
 		return multistep.ActionContinue
 	}
 
-	ui.Say("Creating temporary ssh key...")
+	ui.Say(fmt.Sprintf("Creating temporary %s ssh key...", config.Comm.SSHTemporaryKeyPairType))
 
-	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	algorithm, err := sshkey.AlgorithmString(config.Comm.SSHTemporaryKeyPairType)
 	if err != nil {
 		return internal.StepHaltWithError(state, fmt.Errorf("Error generating SSH key: %s", err))
 	}
 
-	// ASN.1 DER encoded form
-	privDer := x509.MarshalPKCS1PrivateKey(priv)
-	privBlk := pem.Block{
-		Type:    "RSA PRIVATE KEY",
-		Headers: nil,
-		Bytes:   privDer,
-	}
-
-	// Marshal the public key into SSH compatible format
-	pub, err := ssh.NewPublicKey(&priv.PublicKey)
+	pair, err := sshkey.GeneratePair(algorithm, nil, config.Comm.SSHTemporaryKeyPairBits)
 	if err != nil {
-		return internal.StepHaltWithError(state, fmt.Errorf("Error creating public ssh key: %s", err))
+		return internal.StepHaltWithError(state, fmt.Errorf("Error generating SSH key: %s", err))
 	}
 
 	// Remember some state for the future
-	pubSSHFormat := string(ssh.MarshalAuthorizedKey(pub))
-	state.Put("ssh_key_public", pubSSHFormat)
+	state.Put("ssh_key_public", string(pair.Public))
 
 	// Set the private key in the config for later
-	config.Comm.SSHPrivateKey = pem.EncodeToMemory(&privBlk)
-	config.Comm.SSHPublicKey = ssh.MarshalAuthorizedKey(pub)
+	config.Comm.SSHPrivateKey = pair.Private
+	config.Comm.SSHPublicKey = pair.Public
 
 	// If we're in debug mode, output the private key to the working directory.
 	if s.Debug {
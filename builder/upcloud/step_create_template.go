@@ -3,12 +3,14 @@ package upcloud
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
 	internal "github.com/UpCloudLtd/upcloud-packer/internal"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	"github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/packerbuilderdata"
+	"github.com/hashicorp/packer-plugin-sdk/random"
 )
 
 // StepCreateTemplate represents the step that creates a storage template from the newly created server
@@ -30,43 +32,137 @@ func (s *StepCreateTemplate) Run(_ context.Context, state multistep.StateBag) mu
 		return internal.StepHaltWithError(state, err)
 	}
 
+	// template titles are rendered once so that all zones share the same timestamp and random suffix
+	titleData := map[string]interface{}{
+		"Timestamp": time.Now().UTC().Format("20060102-150405"),
+		"Random":    random.AlphaNumLower(8),
+	}
+	if rawGeneratedData, ok := state.GetOk("generated_data"); ok {
+		for k, v := range rawGeneratedData.(map[string]interface{}) {
+			titleData[k] = v
+		}
+	}
+
+	sourceStorageUuid := ""
+	if rawStorage, ok := state.GetOk("source_storage"); ok {
+		sourceStorageUuid = rawStorage.(*upcloud.Storage).UUID
+	}
+	labels := s.Config.labels(s.Config.TemplateLabels, sourceStorageUuid)
+
 	// clonning to zones
 	cleanupStorageUuid := []string{}
 	storageUuids := []string{}
 	storageUuids = append(storageUuids, storage.UUID)
+	titles := map[string]string{}
+
+	title, err := s.templateTitle(s.Config.Zone, titleData)
+	if err != nil {
+		return internal.StepHaltWithError(state, err)
+	}
+	titles[storage.UUID] = title
 
 	for _, zone := range s.Config.CloneZones {
+		title, err := s.templateTitle(zone, titleData)
+		if err != nil {
+			return internal.StepHaltWithError(state, err)
+		}
+
 		ui.Say(fmt.Sprintf("Cloning storage %q to zone %q...", storage.UUID, zone))
-		title := fmt.Sprintf("packer-%s-%s-cloned-disk1", s.Config.TemplatePrefix, internal.GetNowString())
-		clonedStorage, err := driver.CloneStorage(storage.UUID, zone, title)
+		clonedStorage, err := driver.CloneStorage(storage.UUID, zone, fmt.Sprintf("packer-%s-cloned-disk1", title), s.Config.StorageEncryption)
 		if err != nil {
 			return internal.StepHaltWithError(state, err)
 		}
 		storageUuids = append(storageUuids, clonedStorage.UUID)
 		cleanupStorageUuid = append(cleanupStorageUuid, clonedStorage.UUID)
+		titles[clonedStorage.UUID] = title
+		state.Put("cleanup_storage_uuids", cleanupStorageUuid)
+
+		if err := driver.SetStorageLabels(clonedStorage.UUID, labels); err != nil {
+			return internal.StepHaltWithError(state, err)
+		}
 	}
 	ui.Say("Clonning completed...")
 
 	// creating template
 	templates := []*upcloud.Storage{}
 
+	// templates created before a failure would otherwise stay in the account
+	halt := func(err error) multistep.StepAction {
+		s.deleteTemplates(state, templates)
+		return internal.StepHaltWithError(state, err)
+	}
+
 	for _, uuid := range storageUuids {
-		ui.Say(fmt.Sprintf("Creating template for storage %q...", uuid))
+		ui.Say(fmt.Sprintf("Creating template %q for storage %q...", titles[uuid], uuid))
 
-		t, err := driver.CreateTemplate(uuid, s.Config.TemplatePrefix)
+		t, err := driver.CreateTemplate(uuid, titles[uuid])
 		if err != nil {
-			return internal.StepHaltWithError(state, err)
+			return halt(err)
 		}
 		templates = append(templates, t)
+
+		if err := driver.SetStorageLabels(t.UUID, labels); err != nil {
+			return halt(err)
+		}
+
+		if s.Config.StorageEncryption {
+			encrypted, err := driver.IsStorageEncrypted(t.UUID)
+			if err != nil {
+				return halt(err)
+			}
+			if !encrypted {
+				return halt(fmt.Errorf("Template %q is not encrypted", t.UUID))
+			}
+		}
 		ui.Say(fmt.Sprintf("Template for storage %q created...", uuid))
 	}
 
 	state.Put("cleanup_storage_uuids", cleanupStorageUuid)
 	state.Put("templates", templates)
+	// every template was verified to be encrypted
+	state.Put("storage_encrypted", s.Config.StorageEncryption)
+
+	// the first template is always the one in the build zone
+	s.GeneratedData.Put("TemplateUUID", templates[0].UUID)
+	s.GeneratedData.Put("TemplateTitle", templates[0].Title)
+	s.GeneratedData.Put("TemplateSize", templates[0].Size)
+
+	for _, t := range templates {
+		s.GeneratedData.Put(internal.ZoneVariableName("TemplateUUID", t.Zone), t.UUID)
+		s.GeneratedData.Put(internal.ZoneVariableName("TemplateTitle", t.Zone), t.Title)
+		s.GeneratedData.Put(internal.ZoneVariableName("TemplateSize", t.Zone), t.Size)
+	}
 
 	return multistep.ActionContinue
 }
 
+// templateTitle returns the title of the template created in the given zone
+func (s *StepCreateTemplate) templateTitle(zone string, data map[string]interface{}) (string, error) {
+	if s.Config.TemplateName == "" {
+		return fmt.Sprintf("%s-%s", s.Config.TemplatePrefix, internal.GetNowString()), nil
+	}
+
+	title, err := s.Config.renderTemplateName(zone, data)
+	if err != nil {
+		return "", fmt.Errorf("Error rendering template name: %s", err)
+	}
+	return title, nil
+}
+
+// deleteTemplates deletes the templates created before the step failed
+func (s *StepCreateTemplate) deleteTemplates(state multistep.StateBag, templates []*upcloud.Storage) {
+	ui := state.Get("ui").(packer.Ui)
+	driver := state.Get("driver").(internal.Driver)
+
+	for _, t := range templates {
+		ui.Say(fmt.Sprintf("Deleting template %q...", t.UUID))
+
+		if err := driver.DeleteTemplate(t.UUID); err != nil {
+			ui.Error(err.Error())
+		}
+	}
+}
+
 // Cleanup cleans up after the step
 func (s *StepCreateTemplate) Cleanup(state multistep.StateBag) {
 	rawStorageUuids, ok := state.GetOk("cleanup_storage_uuids")
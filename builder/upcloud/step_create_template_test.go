@@ -0,0 +1,62 @@
+package upcloud
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/packerbuilderdata"
+)
+
+func TestStepCreateTemplate_notEncrypted(t *testing.T) {
+	driver := &MockDriver{ServerStorageUuid: "disk-uuid"}
+
+	state := new(multistep.BasicStateBag)
+	state.Put("ui", packersdk.TestUi(t))
+	state.Put("driver", driver)
+	state.Put("server_uuid", "server-uuid")
+
+	step := &StepCreateTemplate{
+		Config:        &Config{Zone: "nl-ams1", TemplatePrefix: "test", StorageEncryption: true},
+		GeneratedData: &packerbuilderdata.GeneratedData{State: state},
+	}
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("Expected the step to halt, got: %v", action)
+	}
+
+	if len(driver.DeletedTemplates) != 1 || driver.DeletedTemplates[0] != "template-disk-uuid" {
+		t.Errorf("Expected the unencrypted template to be deleted, got: %v", driver.DeletedTemplates)
+	}
+
+	if _, ok := state.GetOk("templates"); ok {
+		t.Error("Expected no templates in state")
+	}
+}
+
+func TestStepCreateTemplate_labelsFailed(t *testing.T) {
+	driver := &MockDriver{
+		ServerStorageUuid:   "disk-uuid",
+		SetStorageLabelsErr: errors.New("Error setting labels"),
+	}
+
+	state := new(multistep.BasicStateBag)
+	state.Put("ui", packersdk.TestUi(t))
+	state.Put("driver", driver)
+	state.Put("server_uuid", "server-uuid")
+
+	step := &StepCreateTemplate{
+		Config:        &Config{Zone: "nl-ams1", TemplatePrefix: "test"},
+		GeneratedData: &packerbuilderdata.GeneratedData{State: state},
+	}
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("Expected the step to halt, got: %v", action)
+	}
+
+	if len(driver.DeletedTemplates) != 1 || driver.DeletedTemplates[0] != "template-disk-uuid" {
+		t.Errorf("Expected the unlabelled template to be deleted, got: %v", driver.DeletedTemplates)
+	}
+}
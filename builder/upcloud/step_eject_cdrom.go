@@ -0,0 +1,37 @@
+package upcloud
+
+import (
+	"context"
+
+	internal "github.com/UpCloudLtd/upcloud-packer/internal"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepEjectCDROM represents the step that ejects the CD-ROM attached with the
+// cdrom option before the server is stopped
+type StepEjectCDROM struct {
+	Config *Config
+}
+
+// Run runs the actual step
+func (s *StepEjectCDROM) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	if s.Config.CDROM == "" {
+		return multistep.ActionContinue
+	}
+
+	ui := state.Get("ui").(packer.Ui)
+	driver := state.Get("driver").(internal.Driver)
+	serverUuid := state.Get("server_uuid").(string)
+
+	ui.Say("Ejecting CD-ROM...")
+
+	if err := driver.EjectCDROM(serverUuid); err != nil {
+		return internal.StepHaltWithError(state, err)
+	}
+
+	return multistep.ActionContinue
+}
+
+// Cleanup cleans up after the step
+func (s *StepEjectCDROM) Cleanup(state multistep.StateBag) {}
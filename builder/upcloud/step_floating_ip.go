@@ -0,0 +1,141 @@
+package upcloud
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
+	internal "github.com/UpCloudLtd/upcloud-packer/internal"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/packerbuilderdata"
+)
+
+// floatingIPCommand adds the floating IP to the interface of the default route
+// and makes it the source address of outgoing traffic. The address is not
+// persisted, so the template doesn't carry it. Requires a Linux guest with ip
+// and awk, and passwordless sudo unless connecting as root.
+const floatingIPCommand = `set -e
+dev=$(ip -4 route show default | awk '{print $5; exit}')
+gw=$(ip -4 route show default | awk '{print $3; exit}')
+%[1]sip addr add %[2]s/32 dev "$dev"
+%[1]sip route replace default via "$gw" dev "$dev" src %[2]s
+`
+
+// StepAttachFloatingIP represents the step that attaches an existing or a temporary
+// floating IP to the public interface of the server
+type StepAttachFloatingIP struct {
+	Config        *Config
+	GeneratedData *packerbuilderdata.GeneratedData
+}
+
+// Run runs the actual step
+func (s *StepAttachFloatingIP) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	if s.Config.FloatingIP == "" && !s.Config.TemporaryFloatingIP {
+		return multistep.ActionContinue
+	}
+
+	ui := state.Get("ui").(packer.Ui)
+	driver := state.Get("driver").(internal.Driver)
+	serverUuid := state.Get("server_uuid").(string)
+
+	var ip *upcloud.IPAddress
+	var err error
+	if s.Config.TemporaryFloatingIP {
+		ui.Say("Creating temporary floating IP...")
+		ip, err = driver.CreateFloatingIP(serverUuid)
+		if err != nil {
+			return internal.StepHaltWithError(state, err)
+		}
+		state.Put("floating_ip_temporary", true)
+	} else {
+		ui.Say(fmt.Sprintf("Attaching floating IP %q...", s.Config.FloatingIP))
+		ip, err = driver.AttachFloatingIP(serverUuid, s.Config.FloatingIP)
+		if err != nil {
+			return internal.StepHaltWithError(state, err)
+		}
+	}
+
+	ui.Say(fmt.Sprintf("Floating IP %q attached to the server", ip.Address))
+
+	state.Put("floating_ip", ip.Address)
+	s.GeneratedData.Put("FloatingIP", ip.Address)
+
+	return multistep.ActionContinue
+}
+
+// Cleanup detaches the floating IP, temporary floating IPs are released
+func (s *StepAttachFloatingIP) Cleanup(state multistep.StateBag) {
+	rawAddress, ok := state.GetOk("floating_ip")
+	if !ok {
+		return
+	}
+	address := rawAddress.(string)
+
+	ui := state.Get("ui").(packer.Ui)
+	driver := state.Get("driver").(internal.Driver)
+
+	if keepServerOnFailure(s.Config, state) {
+		ui.Say(fmt.Sprintf("Keeping floating IP %q attached to the kept server, detach it manually when done", address))
+		return
+	}
+
+	ui.Say(fmt.Sprintf("Detaching floating IP %q...", address))
+	if err := driver.DetachFloatingIP(address); err != nil {
+		ui.Error(err.Error())
+		return
+	}
+
+	if _, ok := state.GetOk("floating_ip_temporary"); ok {
+		ui.Say(fmt.Sprintf("Releasing temporary floating IP %q...", address))
+		if err := driver.ReleaseFloatingIP(address); err != nil {
+			ui.Error(err.Error())
+		}
+	}
+}
+
+// StepConfigureFloatingIP represents the step that configures the floating IP on the
+// server for outgoing traffic, and reconnects the communicator through it when
+// 'ssh_interface' is 'public_ipv4'
+type StepConfigureFloatingIP struct {
+	Config *Config
+	// Connect is the step that connected the communicator, it is cleaned up and
+	// run again to reconnect to the floating IP
+	Connect multistep.Step
+}
+
+// Run runs the actual step
+func (s *StepConfigureFloatingIP) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	rawAddress, ok := state.GetOk("floating_ip")
+	if !ok {
+		return multistep.ActionContinue
+	}
+	address := rawAddress.(string)
+
+	ui := state.Get("ui").(packer.Ui)
+	comm := state.Get("communicator").(packer.Communicator)
+
+	ui.Say(fmt.Sprintf("Configuring floating IP %q on the server...", address))
+
+	cmd := &packer.RemoteCmd{Command: fmt.Sprintf(floatingIPCommand, s.Config.sudoPrefix(), address)}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		return internal.StepHaltWithError(state, fmt.Errorf("Error configuring floating IP: %s", err))
+	}
+
+	if cmd.ExitStatus() != 0 {
+		return internal.StepHaltWithError(state, fmt.Errorf("Configuring floating IP failed with exit status %d", cmd.ExitStatus()))
+	}
+
+	if s.Config.SSHInterface != internal.SSHInterfacePublicIPv4 {
+		return multistep.ActionContinue
+	}
+
+	ui.Say(fmt.Sprintf("Reconnecting through floating IP %q...", address))
+	s.Connect.Cleanup(state)
+	state.Remove("communicator")
+	state.Put("server_ip", address)
+	return s.Connect.Run(ctx, state)
+}
+
+// Cleanup cleans up after the step
+func (s *StepConfigureFloatingIP) Cleanup(state multistep.StateBag) {}
@@ -0,0 +1,103 @@
+package upcloud
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	internal "github.com/UpCloudLtd/upcloud-packer/internal"
+	"github.com/hashicorp/packer-plugin-sdk/communicator"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// mockConnectStep records the calls of the connect step and connects a new mock communicator
+type mockConnectStep struct {
+	calls []string
+	comm  *packersdk.MockCommunicator
+}
+
+func (s *mockConnectStep) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	if _, ok := state.GetOk("communicator"); ok {
+		s.calls = append(s.calls, "run-connected")
+	} else {
+		s.calls = append(s.calls, "run")
+	}
+	s.comm = new(packersdk.MockCommunicator)
+	state.Put("communicator", s.comm)
+	return multistep.ActionContinue
+}
+
+func (s *mockConnectStep) Cleanup(multistep.StateBag) {
+	s.calls = append(s.calls, "cleanup")
+}
+
+func TestStepConfigureFloatingIP_reconnect(t *testing.T) {
+	comm := new(packersdk.MockCommunicator)
+
+	state := new(multistep.BasicStateBag)
+	state.Put("ui", packersdk.TestUi(t))
+	state.Put("communicator", comm)
+	state.Put("server_ip", "192.0.2.10")
+	state.Put("floating_ip", "198.51.100.20")
+
+	connect := &mockConnectStep{}
+	step := &StepConfigureFloatingIP{
+		Config: &Config{
+			Comm:         communicator.Config{SSH: communicator.SSH{SSHUsername: "ubuntu"}},
+			SSHInterface: internal.SSHInterfacePublicIPv4,
+		},
+		Connect: connect,
+	}
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("Unexpected action: %v, error: %v", action, state.Get("error"))
+	}
+
+	if !comm.StartCalled || !strings.Contains(comm.StartCmd.Command, "sudo ip addr add 198.51.100.20/32") {
+		t.Errorf("Floating IP not configured with the first connection: %+v", comm.StartCmd)
+	}
+
+	if strings.Join(connect.calls, ",") != "cleanup,run" {
+		t.Errorf("Expected the connect step to be cleaned up before reconnecting, got: %v", connect.calls)
+	}
+
+	if state.Get("server_ip") != "198.51.100.20" {
+		t.Errorf("Expected server_ip to be the floating IP, got: %v", state.Get("server_ip"))
+	}
+
+	if state.Get("communicator") != connect.comm {
+		t.Errorf("Expected the communicator of the new connection")
+	}
+}
+
+func TestStepConfigureFloatingIP_noReconnect(t *testing.T) {
+	comm := new(packersdk.MockCommunicator)
+
+	state := new(multistep.BasicStateBag)
+	state.Put("ui", packersdk.TestUi(t))
+	state.Put("communicator", comm)
+	state.Put("server_ip", "10.0.0.10")
+	state.Put("floating_ip", "198.51.100.20")
+
+	connect := &mockConnectStep{}
+	step := &StepConfigureFloatingIP{
+		Config: &Config{
+			Comm:         communicator.Config{SSH: communicator.SSH{SSHUsername: "root"}},
+			SSHInterface: internal.SSHInterfacePrivate,
+		},
+		Connect: connect,
+	}
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("Unexpected action: %v, error: %v", action, state.Get("error"))
+	}
+
+	if !comm.StartCalled || strings.Contains(comm.StartCmd.Command, "sudo") {
+		t.Errorf("Expected the floating IP to be configured without sudo: %+v", comm.StartCmd)
+	}
+
+	if len(connect.calls) != 0 || state.Get("server_ip") != "10.0.0.10" {
+		t.Errorf("Expected no reconnect, got calls %v and server_ip %v", connect.calls, state.Get("server_ip"))
+	}
+}
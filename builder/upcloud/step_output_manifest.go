@@ -0,0 +1,110 @@
+package upcloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
+	internal "github.com/UpCloudLtd/upcloud-packer/internal"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// Manifest is the document written to the 'output_manifest' path
+type Manifest struct {
+	BuildName        string                 `json:"build_name"`
+	BuildTime        string                 `json:"build_time"`
+	SourceStorage    ManifestStorage        `json:"source_storage"`
+	Templates        []ManifestTemplate     `json:"templates"`
+	StorageEncrypted bool                   `json:"storage_encrypted"`
+	GeneratedData    map[string]interface{} `json:"generated_data"`
+}
+
+// ManifestStorage describes the storage the build server was created from
+type ManifestStorage struct {
+	UUID  string `json:"uuid"`
+	Title string `json:"title"`
+	Zone  string `json:"zone"`
+}
+
+// ManifestTemplate describes a single created template
+type ManifestTemplate struct {
+	Zone  string `json:"zone"`
+	UUID  string `json:"uuid"`
+	Title string `json:"title"`
+	Size  int    `json:"size"`
+	Tier  string `json:"tier"`
+}
+
+// StepOutputManifest represents the step that writes the build manifest file
+type StepOutputManifest struct {
+	Config *Config
+}
+
+// Run runs the actual step
+func (s *StepOutputManifest) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	if s.Config.OutputManifest == "" {
+		return multistep.ActionContinue
+	}
+
+	ui := state.Get("ui").(packer.Ui)
+
+	ui.Say(fmt.Sprintf("Writing manifest to %q...", s.Config.OutputManifest))
+
+	data, err := json.MarshalIndent(newManifest(s.Config.PackerBuildName, state), "", "  ")
+	if err != nil {
+		return internal.StepHaltWithError(state, fmt.Errorf("Error encoding manifest: %s", err))
+	}
+
+	if err := ioutil.WriteFile(s.Config.OutputManifest, data, 0644); err != nil {
+		return internal.StepHaltWithError(state, fmt.Errorf("Error writing manifest: %s", err))
+	}
+
+	state.Put("manifest_path", s.Config.OutputManifest)
+
+	return multistep.ActionContinue
+}
+
+// Cleanup cleans up after the step
+func (s *StepOutputManifest) Cleanup(state multistep.StateBag) {}
+
+func newManifest(buildName string, state multistep.StateBag) *Manifest {
+	manifest := &Manifest{
+		BuildName:     buildName,
+		Templates:     []ManifestTemplate{},
+		GeneratedData: map[string]interface{}{},
+	}
+
+	if rawGeneratedData, ok := state.GetOk("generated_data"); ok {
+		manifest.GeneratedData = rawGeneratedData.(map[string]interface{})
+		manifest.BuildTime, _ = manifest.GeneratedData["BuildTimestamp"].(string)
+	}
+
+	if rawStorage, ok := state.GetOk("source_storage"); ok {
+		storage := rawStorage.(*upcloud.Storage)
+		manifest.SourceStorage = ManifestStorage{
+			UUID:  storage.UUID,
+			Title: storage.Title,
+			Zone:  storage.Zone,
+		}
+	}
+
+	if rawTemplates, ok := state.GetOk("templates"); ok {
+		for _, t := range rawTemplates.([]*upcloud.Storage) {
+			manifest.Templates = append(manifest.Templates, ManifestTemplate{
+				Zone:  t.Zone,
+				UUID:  t.UUID,
+				Title: t.Title,
+				Size:  t.Size,
+				Tier:  t.Tier,
+			})
+		}
+	}
+
+	if encrypted, ok := state.GetOk("storage_encrypted"); ok {
+		manifest.StorageEncrypted = encrypted.(bool)
+	}
+	return manifest
+}
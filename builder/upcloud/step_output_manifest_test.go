@@ -0,0 +1,66 @@
+package upcloud
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestStepOutputManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upcloud-manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "manifest.json")
+
+	state := new(multistep.BasicStateBag)
+	state.Put("ui", packersdk.TestUi(t))
+	state.Put("generated_data", map[string]interface{}{"BuildTimestamp": "2021-02-06T21:38:58Z"})
+	state.Put("source_storage", &upcloud.Storage{UUID: "source-uuid", Title: "source", Zone: "nl-ams1"})
+	state.Put("templates", []*upcloud.Storage{
+		{UUID: "uuid-1", Zone: "nl-ams1", Size: 25, Tier: upcloud.StorageTierMaxIOPS},
+		{UUID: "uuid-2", Zone: "fi-hel1", Size: 25, Tier: upcloud.StorageTierMaxIOPS},
+	})
+	state.Put("storage_encrypted", true)
+
+	step := &StepOutputManifest{Config: &Config{OutputManifest: path}}
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("Unexpected action: %v, error: %v", action, state.Get("error"))
+	}
+
+	if state.Get("manifest_path") != path {
+		t.Errorf("Expected manifest_path %q, got: %v", path, state.Get("manifest_path"))
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	if manifest.SourceStorage.UUID != "source-uuid" {
+		t.Errorf("Expected source storage %q, got: %q", "source-uuid", manifest.SourceStorage.UUID)
+	}
+	if len(manifest.Templates) != 2 || manifest.Templates[1].Zone != "fi-hel1" {
+		t.Errorf("Unexpected templates: %+v", manifest.Templates)
+	}
+	if !manifest.StorageEncrypted {
+		t.Error("Expected encrypted templates")
+	}
+	if manifest.BuildTime != "2021-02-06T21:38:58Z" {
+		t.Errorf("Unexpected build time: %v", manifest.BuildTime)
+	}
+}
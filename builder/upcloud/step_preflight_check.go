@@ -0,0 +1,100 @@
+package upcloud
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
+	internal "github.com/UpCloudLtd/upcloud-packer/internal"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepPreflightCheck represents the step that checks the account has enough resources and credits for the build
+type StepPreflightCheck struct {
+	Config *Config
+}
+
+// Run runs the actual step
+func (s *StepPreflightCheck) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	if s.Config.SkipPreflightCheck {
+		return multistep.ActionContinue
+	}
+
+	ui := state.Get("ui").(packer.Ui)
+	driver := state.Get("driver").(internal.Driver)
+
+	ui.Say("Checking account resource limits...")
+
+	account, err := driver.GetAccountResources()
+	if err != nil {
+		// e.g. sub-accounts without access to account details
+		ui.Message(fmt.Sprintf("Skipping pre-flight check: %s", err))
+		return multistep.ActionContinue
+	}
+
+	required, templateSize := s.requiredResources()
+	ui.Message(fmt.Sprintf("Build needs %d CPU core(s), %d MB memory, %d public IPv4 address(es) and %d GB MaxIOPS storage (build disk %d GB, %d clone(s), %d template(s))",
+		required.Cores, required.Memory, required.PublicIPv4, required.StorageSSD,
+		s.Config.StorageSize, len(s.Config.CloneZones), len(s.Config.CloneZones)+1))
+
+	problems := internal.CheckResources(account, required)
+
+	priceZone, err := driver.GetPriceZone(s.Config.Zone)
+	if err != nil {
+		ui.Message(fmt.Sprintf("Skipping credit check: %s", err))
+	} else {
+		price := internal.EstimatePrice(priceZone, required, templateSize)
+		ui.Message(fmt.Sprintf("Build resources cost about %.2f cents per hour, account has %.2f cents of credits", price, account.Credits))
+		if account.Credits < price {
+			problems = append(problems, fmt.Sprintf("Credits: %.2f cents available, build needs about %.2f cents per hour", account.Credits, price))
+		}
+	}
+
+	if len(problems) > 0 {
+		return internal.StepHaltWithError(state, fmt.Errorf("Account resources are not sufficient for the build, set 'skip_preflight_check' to ignore:\n%s",
+			strings.Join(problems, "\n")))
+	}
+
+	return multistep.ActionContinue
+}
+
+// requiredResources returns the resources needed at the peak of the build and the total size of the templates
+func (s *StepPreflightCheck) requiredResources() (internal.Resources, int) {
+	required := internal.Resources{
+		Cores:  internal.DefaultPlanCores,
+		Memory: internal.DefaultPlanMemory,
+	}
+
+	for _, iface := range s.Config.Networking {
+		if iface.Type != upcloud.IPAddressAccessPublic {
+			continue
+		}
+		for _, ip := range iface.IPAddresses {
+			if ip.Family == upcloud.IPAddressFamilyIPv4 {
+				required.PublicIPv4++
+			}
+		}
+	}
+
+	// the build disk, its clones in other zones and a template in every zone exist at the same time
+	templateSize := s.Config.StorageSize * (len(s.Config.CloneZones) + 1)
+	required.StorageSSD = s.Config.StorageSize + s.Config.StorageSize*len(s.Config.CloneZones) + templateSize
+
+	if s.Config.TemporaryFloatingIP {
+		required.PublicIPv4++
+	}
+
+	if s.Config.AutoBastion {
+		required.Cores += internal.DefaultPlanCores
+		required.Memory += internal.DefaultPlanMemory
+		required.PublicIPv4++
+		required.StorageSSD += MinStorageSize
+	}
+
+	return required, templateSize
+}
+
+// Cleanup cleans up after the step
+func (s *StepPreflightCheck) Cleanup(state multistep.StateBag) {}
@@ -0,0 +1,49 @@
+package upcloud
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
+	internal "github.com/UpCloudLtd/upcloud-packer/internal"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestStepPreflightCheck_credits(t *testing.T) {
+	priceZone := &upcloud.PriceZone{
+		ServerPlan2xCPU2GB: &upcloud.Price{Amount: 1, Price: 2.2},
+		StorageMaxIOPS:     &upcloud.Price{Amount: 1, Price: 0.03},
+	}
+
+	tests := []struct {
+		credits float64
+		action  multistep.StepAction
+	}{
+		{0, multistep.ActionHalt},
+		{1, multistep.ActionHalt},
+		{1000, multistep.ActionContinue},
+	}
+
+	for _, test := range tests {
+		driver := &MockDriver{
+			AccountResources: &internal.AccountResources{Credits: test.credits},
+			PriceZone:        priceZone,
+		}
+
+		state := new(multistep.BasicStateBag)
+		state.Put("ui", packersdk.TestUi(t))
+		state.Put("driver", driver)
+
+		step := &StepPreflightCheck{Config: &Config{Zone: "nl-ams1", StorageSize: 25}}
+		action := step.Run(context.Background(), state)
+		if action != test.action {
+			t.Errorf("Expected action %v for %.2f credits, got: %v", test.action, test.credits, action)
+		}
+
+		if err, ok := state.GetOk("error"); test.action == multistep.ActionHalt && (!ok || !strings.Contains(err.(error).Error(), "Credits")) {
+			t.Errorf("Expected credits error for %.2f credits, got: %v", test.credits, err)
+		}
+	}
+}
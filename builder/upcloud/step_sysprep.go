@@ -0,0 +1,69 @@
+package upcloud
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+
+	internal "github.com/UpCloudLtd/upcloud-packer/internal"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepSysprep represents the step that generalizes a Windows server and removes
+// the WinRM bootstrap configuration before it is stopped
+type StepSysprep struct {
+	Config *Config
+}
+
+// Run runs the actual step
+func (s *StepSysprep) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	if !s.Config.WindowsSysprep && !s.Config.winRMBootstrap {
+		return multistep.ActionContinue
+	}
+
+	ui := state.Get("ui").(packer.Ui)
+	comm := state.Get("communicator").(packer.Communicator)
+
+	if s.Config.WindowsSysprep {
+		ui.Say("Generalizing Windows installation with sysprep...")
+
+		cmd := &packer.RemoteCmd{Command: s.Config.SysprepCommand}
+		if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+			return internal.StepHaltWithError(state, fmt.Errorf("Error running sysprep: %s", err))
+		}
+
+		if cmd.ExitStatus() != 0 {
+			return internal.StepHaltWithError(state, fmt.Errorf("Sysprep failed with exit status %d", cmd.ExitStatus()))
+		}
+	}
+
+	if s.Config.winRMBootstrap {
+		ui.Say("Removing WinRM listener and firewall rule...")
+
+		// removing the listener closes the connection, so the result of the command is not reliable
+		state.Put("winrm_listener_removed", true)
+		cmd := &packer.RemoteCmd{Command: encodedPowerShell(DefaultWinRMCleanupScript)}
+		if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+			ui.Message(fmt.Sprintf("The WinRM connection was closed while removing the listener: %s", err))
+		}
+	}
+
+	return multistep.ActionContinue
+}
+
+// Cleanup cleans up after the step
+func (s *StepSysprep) Cleanup(state multistep.StateBag) {}
+
+// encodedPowerShell returns a command running the script with -EncodedCommand,
+// which avoids quoting the script for cmd.exe
+func encodedPowerShell(script string) string {
+	encoded := utf16.Encode([]rune(script))
+	buf := make([]byte, len(encoded)*2)
+	for i, c := range encoded {
+		binary.LittleEndian.PutUint16(buf[i*2:], c)
+	}
+	return fmt.Sprintf("powershell -NoProfile -NonInteractive -EncodedCommand %s", base64.StdEncoding.EncodeToString(buf))
+}
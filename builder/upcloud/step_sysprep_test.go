@@ -0,0 +1,27 @@
+package upcloud
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestEncodedPowerShell(t *testing.T) {
+	cmd := encodedPowerShell("echo 'ok'")
+
+	prefix := "powershell -NoProfile -NonInteractive -EncodedCommand "
+	if !strings.HasPrefix(cmd, prefix) {
+		t.Fatalf("Unexpected command: %s", cmd)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(cmd, prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// UTF-16LE
+	expected := []byte{'e', 0, 'c', 0, 'h', 0, 'o', 0, ' ', 0, '\'', 0, 'o', 0, 'k', 0, '\'', 0}
+	if string(data) != string(expected) {
+		t.Errorf("Unexpected encoded script: %v", data)
+	}
+}
@@ -10,10 +10,12 @@ import (
 )
 
 // StepTeardownServer represents the step that stops the server before creating the image
-type StepTeardownServer struct{}
+type StepTeardownServer struct {
+	Config *Config
+}
 
 // Run runs the actual step
-func (s *StepTeardownServer) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+func (s *StepTeardownServer) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
 	// Extract server details
 	serverUuid := state.Get("server_uuid").(string)
 	serverTitle := state.Get("server_title").(string)
@@ -21,6 +23,30 @@ func (s *StepTeardownServer) Run(_ context.Context, state multistep.StateBag) mu
 	ui := state.Get("ui").(packer.Ui)
 	driver := state.Get("driver").(internal.Driver)
 
+	shutdownCommand := s.Config.ShutdownCommand
+	if _, ok := state.GetOk("winrm_listener_removed"); ok && shutdownCommand != "" {
+		ui.Say("The WinRM listener is removed, stopping the server through the API instead of 'shutdown_command'")
+		shutdownCommand = ""
+	}
+
+	if shutdownCommand != "" {
+		comm := state.Get("communicator").(packer.Communicator)
+
+		ui.Say(fmt.Sprintf("Gracefully shutting down server %q...", serverTitle))
+
+		cmd := &packer.RemoteCmd{Command: shutdownCommand}
+		if err := comm.Start(ctx, cmd); err != nil {
+			return internal.StepHaltWithError(state, fmt.Errorf("Failed to send shutdown command: %s", err))
+		}
+
+		err := driver.WaitServerStopped(serverUuid, s.Config.ShutdownTimeout)
+		if err == nil {
+			ui.Say(fmt.Sprintf("Server %q is now in 'stopped' state", serverTitle))
+			return multistep.ActionContinue
+		}
+		ui.Say(fmt.Sprintf("Server %q did not stop within %s, stopping it through the API...", serverTitle, s.Config.ShutdownTimeout))
+	}
+
 	ui.Say(fmt.Sprintf("Stopping server %q...", serverTitle))
 
 	err := driver.StopServer(serverUuid)
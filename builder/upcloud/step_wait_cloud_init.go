@@ -0,0 +1,51 @@
+package upcloud
+
+import (
+	"context"
+	"fmt"
+
+	internal "github.com/UpCloudLtd/upcloud-packer/internal"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+const cloudInitWaitCommand = "cloud-init status --wait"
+
+// StepWaitCloudInit represents the step that waits for cloud-init to finish before provisioning
+type StepWaitCloudInit struct {
+	Config *Config
+}
+
+// Run runs the actual step
+func (s *StepWaitCloudInit) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	if !s.Config.CloudInitWait {
+		return multistep.ActionContinue
+	}
+
+	ui := state.Get("ui").(packer.Ui)
+	comm := state.Get("communicator").(packer.Communicator)
+
+	ui.Say("Waiting for cloud-init to finish...")
+
+	ctx, cancel := context.WithTimeout(ctx, s.Config.CloudInitTimeout)
+	defer cancel()
+
+	cmd := &packer.RemoteCmd{Command: cloudInitWaitCommand}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		return internal.StepHaltWithError(state, fmt.Errorf("Error waiting for cloud-init: %s", err))
+	}
+
+	// exit status 2 is used by newer cloud-init versions for recoverable errors
+	switch cmd.ExitStatus() {
+	case 0:
+	case 2:
+		ui.Message("cloud-init finished with recoverable errors")
+	default:
+		return internal.StepHaltWithError(state, fmt.Errorf("cloud-init failed with exit status %d", cmd.ExitStatus()))
+	}
+
+	return multistep.ActionContinue
+}
+
+// Cleanup cleans up after the step
+func (s *StepWaitCloudInit) Cleanup(state multistep.StateBag) {}
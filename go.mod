@@ -6,6 +6,7 @@ require (
 	github.com/UpCloudLtd/upcloud-go-api v0.0.0-20210127073406-2964ed7e5972
 	github.com/hashicorp/hcl/v2 v2.8.0
 	github.com/hashicorp/packer-plugin-sdk v0.0.10
+	github.com/mitchellh/mapstructure v1.4.0
 	github.com/zclconf/go-cty v1.7.0
 	golang.org/x/crypto v0.0.0-20201208171446-5f87f3452ae9
 )
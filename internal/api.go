@@ -0,0 +1,430 @@
+package upcloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud/client"
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud/request"
+)
+
+// This file contains requests for UpCloud API features which are not yet
+// supported by upcloud-go-api. The requests follow the same conventions as
+// the ones in the upcloud-go-api request package and are performed with its client.
+
+const (
+	// LabelBuilder is added to every resource created by the builder
+	LabelBuilder      = "packer-builder"
+	LabelBuilderValue = "upcloud"
+
+	// LabelExpiresAt holds the time a server kept on failure can be deleted
+	LabelExpiresAt = "packer-expires-at"
+
+	// LabelCreatedAt holds the UTC creation time of a resource, used for its age by the sweep subcommand
+	LabelCreatedAt = "packer-created-at"
+)
+
+// Label represents a key-value label of a server or a storage
+type Label struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// LabelSlice is a slice of labels.
+// It exists to allow for a custom JSON marshaller and unmarshaller.
+type LabelSlice []Label
+
+// MarshalJSON is a custom marshaller that deals with
+// deeply embedded values.
+func (s LabelSlice) MarshalJSON() ([]byte, error) {
+	v := struct {
+		Label []Label `json:"label"`
+	}{}
+	v.Label = s
+
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON is a custom unmarshaller that accepts labels both as
+// {"label": [...]} (servers) and as a plain list (storages).
+func (s *LabelSlice) UnmarshalJSON(b []byte) error {
+	var labels []Label
+	if err := json.Unmarshal(b, &labels); err == nil {
+		(*s) = labels
+		return nil
+	}
+
+	v := struct {
+		Label []Label `json:"label"`
+	}{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	(*s) = v.Label
+
+	return nil
+}
+
+// NewLabels converts a map of labels into a slice sorted by key
+func NewLabels(labels map[string]string) []Label {
+	result := []Label{}
+	for k, v := range labels {
+		result = append(result, Label{Key: k, Value: v})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+// createServerRequest extends request.CreateServerRequest with fields unknown to upcloud-go-api
+type createServerRequest struct {
+	request.CreateServerRequest
+
+	Labels   LabelSlice `json:"labels,omitempty"`
+	NICModel string     `json:"nic_model,omitempty"`
+	// StorageEncryption encrypts the disks of the server at rest
+	StorageEncryption bool `json:"-"`
+}
+
+// MarshalJSON is a custom marshaller that deals with
+// deeply embedded values.
+func (r createServerRequest) MarshalJSON() ([]byte, error) {
+	type localCreateServerRequest request.CreateServerRequest
+	v := struct {
+		Server struct {
+			localCreateServerRequest
+			// Metadata is omitted unless enabled, request.CreateServerRequest always sends it
+			Metadata       *upcloud.Boolean               `json:"metadata,omitempty"`
+			Labels         LabelSlice                     `json:"labels,omitempty"`
+			NICModel       string                         `json:"nic_model,omitempty"`
+			StorageDevices createServerStorageDeviceSlice `json:"storage_devices"`
+		} `json:"server"`
+	}{}
+	v.Server.localCreateServerRequest = localCreateServerRequest(r.CreateServerRequest)
+	v.Server.Labels = r.Labels
+	v.Server.NICModel = r.NICModel
+	if r.Metadata.Bool() {
+		v.Server.Metadata = &r.Metadata
+	}
+
+	for _, device := range r.StorageDevices {
+		d := createServerStorageDevice{CreateServerStorageDevice: device}
+		if r.StorageEncryption && device.Type != upcloud.StorageTypeCDROM {
+			d.Encrypted = upcloud.True
+		}
+		v.Server.StorageDevices = append(v.Server.StorageDevices, d)
+	}
+
+	return json.Marshal(&v)
+}
+
+// RequestURL implements the Request interface
+func (r *createServerRequest) RequestURL() string {
+	return r.CreateServerRequest.RequestURL()
+}
+
+// createServerStorageDevice extends request.CreateServerStorageDevice with fields unknown to upcloud-go-api
+type createServerStorageDevice struct {
+	request.CreateServerStorageDevice
+
+	Encrypted upcloud.Boolean `json:"encrypted,omitempty"`
+}
+
+// createServerStorageDeviceSlice is a slice of createServerStorageDevices
+// It exists to allow for a custom JSON marshaller.
+type createServerStorageDeviceSlice []createServerStorageDevice
+
+// MarshalJSON is a custom marshaller that deals with
+// deeply embedded values.
+func (s createServerStorageDeviceSlice) MarshalJSON() ([]byte, error) {
+	v := struct {
+		StorageDevice []createServerStorageDevice `json:"storage_device"`
+	}{}
+	v.StorageDevice = s
+
+	return json.Marshal(v)
+}
+
+// cloneStorageRequest extends request.CloneStorageRequest with fields unknown to upcloud-go-api
+type cloneStorageRequest struct {
+	request.CloneStorageRequest
+
+	Encrypted upcloud.Boolean `json:"encrypted,omitempty"`
+}
+
+// MarshalJSON is a custom marshaller that deals with
+// deeply embedded values.
+func (r cloneStorageRequest) MarshalJSON() ([]byte, error) {
+	type localCloneStorageRequest request.CloneStorageRequest
+	v := struct {
+		Storage struct {
+			localCloneStorageRequest
+			Encrypted upcloud.Boolean `json:"encrypted,omitempty"`
+		} `json:"storage"`
+	}{}
+	v.Storage.localCloneStorageRequest = localCloneStorageRequest(r.CloneStorageRequest)
+	v.Storage.Encrypted = r.Encrypted
+
+	return json.Marshal(&v)
+}
+
+// RequestURL implements the Request interface
+func (r *cloneStorageRequest) RequestURL() string {
+	return r.CloneStorageRequest.RequestURL()
+}
+
+// modifyServerLabelsRequest represents a request to replace the labels of a server
+type modifyServerLabelsRequest struct {
+	UUID string `json:"-"`
+
+	Labels LabelSlice `json:"labels"`
+}
+
+// MarshalJSON is a custom marshaller that deals with
+// deeply embedded values.
+func (r modifyServerLabelsRequest) MarshalJSON() ([]byte, error) {
+	type localModifyServerLabelsRequest modifyServerLabelsRequest
+	v := struct {
+		Server localModifyServerLabelsRequest `json:"server"`
+	}{}
+	v.Server = localModifyServerLabelsRequest(r)
+
+	return json.Marshal(&v)
+}
+
+// RequestURL implements the Request interface
+func (r *modifyServerLabelsRequest) RequestURL() string {
+	return fmt.Sprintf("/server/%s", r.UUID)
+}
+
+// modifyServerFirewallRequest represents a request to enable or disable the firewall of a server
+// without sending the other fields of request.ModifyServerRequest
+type modifyServerFirewallRequest struct {
+	UUID string `json:"-"`
+
+	Firewall string `json:"firewall"`
+}
+
+// MarshalJSON is a custom marshaller that deals with
+// deeply embedded values.
+func (r modifyServerFirewallRequest) MarshalJSON() ([]byte, error) {
+	type localModifyServerFirewallRequest modifyServerFirewallRequest
+	v := struct {
+		Server localModifyServerFirewallRequest `json:"server"`
+	}{}
+	v.Server = localModifyServerFirewallRequest(r)
+
+	return json.Marshal(&v)
+}
+
+// RequestURL implements the Request interface
+func (r *modifyServerFirewallRequest) RequestURL() string {
+	return fmt.Sprintf("/server/%s", r.UUID)
+}
+
+// modifyStorageLabelsRequest represents a request to replace the labels of a storage
+type modifyStorageLabelsRequest struct {
+	UUID string `json:"-"`
+
+	Labels []Label `json:"labels"`
+}
+
+// MarshalJSON is a custom marshaller that deals with
+// deeply embedded values.
+func (r modifyStorageLabelsRequest) MarshalJSON() ([]byte, error) {
+	type localModifyStorageLabelsRequest modifyStorageLabelsRequest
+	v := struct {
+		Storage localModifyStorageLabelsRequest `json:"storage"`
+	}{}
+	v.Storage = localModifyStorageLabelsRequest(r)
+
+	return json.Marshal(&v)
+}
+
+// RequestURL implements the Request interface
+func (r *modifyStorageLabelsRequest) RequestURL() string {
+	return fmt.Sprintf("/storage/%s", r.UUID)
+}
+
+// createGatewayRequest represents a request to create a NAT gateway for the networks of a router
+type createGatewayRequest struct {
+	Name     string          `json:"name"`
+	Zone     string          `json:"zone"`
+	Features []string        `json:"features"`
+	Routers  []gatewayRouter `json:"routers"`
+	Labels   []Label         `json:"labels,omitempty"`
+}
+
+type gatewayRouter struct {
+	UUID string `json:"uuid"`
+}
+
+// RequestURL implements the Request interface
+func (r *createGatewayRequest) RequestURL() string {
+	return "/gateway"
+}
+
+// gateway represents a network gateway
+type gateway struct {
+	UUID             string `json:"uuid"`
+	Name             string `json:"name"`
+	OperationalState string `json:"operational_state"`
+}
+
+func (d *driver) createGateway(r *createGatewayRequest) (*gateway, error) {
+	requestBody, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := d.client.PerformJSONPostRequest(d.client.CreateRequestURL(r.RequestURL()), requestBody)
+	if err != nil {
+		return nil, parseServiceError(err)
+	}
+
+	gw := gateway{}
+	if err := json.Unmarshal(response, &gw); err != nil {
+		return nil, err
+	}
+	return &gw, nil
+}
+
+func (d *driver) getGateway(gatewayUuid string) (*gateway, error) {
+	response, err := d.client.PerformJSONGetRequest(d.client.CreateRequestURL(fmt.Sprintf("/gateway/%s", gatewayUuid)))
+	if err != nil {
+		return nil, parseServiceError(err)
+	}
+
+	gw := gateway{}
+	if err := json.Unmarshal(response, &gw); err != nil {
+		return nil, err
+	}
+	return &gw, nil
+}
+
+func (d *driver) deleteGateway(gatewayUuid string) error {
+	if err := d.client.PerformJSONDeleteRequest(d.client.CreateRequestURL(fmt.Sprintf("/gateway/%s", gatewayUuid))); err != nil {
+		return parseServiceError(err)
+	}
+	return nil
+}
+
+// ServerDetails extends upcloud.ServerDetails with the login credentials
+// which are only returned when the server is created
+type ServerDetails struct {
+	upcloud.ServerDetails
+
+	Username string
+	Password string
+}
+
+func (d *driver) createServer(r *createServerRequest) (*ServerDetails, error) {
+	serverDetails := ServerDetails{}
+	requestBody, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := d.client.PerformJSONPostRequest(d.client.CreateRequestURL(r.RequestURL()), requestBody)
+	if err != nil {
+		return nil, parseServiceError(err)
+	}
+
+	if err := json.Unmarshal(response, &serverDetails.ServerDetails); err != nil {
+		return nil, err
+	}
+
+	credentials := struct {
+		Server struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"server"`
+	}{}
+	if err := json.Unmarshal(response, &credentials); err != nil {
+		return nil, err
+	}
+	serverDetails.Username = credentials.Server.Username
+	serverDetails.Password = credentials.Server.Password
+
+	return &serverDetails, nil
+}
+
+func (d *driver) cloneStorage(r *cloneStorageRequest) (*upcloud.Storage, error) {
+	requestBody, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := d.client.PerformJSONPostRequest(d.client.CreateRequestURL(r.RequestURL()), requestBody)
+	if err != nil {
+		return nil, parseServiceError(err)
+	}
+
+	storageDetails := upcloud.StorageDetails{}
+	if err := json.Unmarshal(response, &storageDetails); err != nil {
+		return nil, err
+	}
+	return &storageDetails.Storage, nil
+}
+
+// getStorageEncrypted returns the encryption status of a storage, which upcloud.Storage doesn't carry
+func (d *driver) getStorageEncrypted(storageUuid string) (bool, error) {
+	response, err := d.client.PerformJSONGetRequest(d.client.CreateRequestURL(fmt.Sprintf("/storage/%s", storageUuid)))
+	if err != nil {
+		return false, parseServiceError(err)
+	}
+
+	details := struct {
+		Storage struct {
+			Encrypted upcloud.Boolean `json:"encrypted"`
+		} `json:"storage"`
+	}{}
+	if err := json.Unmarshal(response, &details); err != nil {
+		return false, err
+	}
+	return details.Storage.Encrypted.Bool(), nil
+}
+
+func (d *driver) modifyServerLabels(r *modifyServerLabelsRequest) error {
+	return d.performPutRequest(r.RequestURL(), r)
+}
+
+func (d *driver) modifyServerFirewall(serverUuid, firewall string) error {
+	r := &modifyServerFirewallRequest{
+		UUID:     serverUuid,
+		Firewall: firewall,
+	}
+	return d.performPutRequest(r.RequestURL(), r)
+}
+
+func (d *driver) modifyStorageLabels(r *modifyStorageLabelsRequest) error {
+	return d.performPutRequest(r.RequestURL(), r)
+}
+
+func (d *driver) performPutRequest(location string, r interface{}) error {
+	requestBody, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.client.PerformJSONPutRequest(d.client.CreateRequestURL(location), requestBody)
+	if err != nil {
+		return parseServiceError(err)
+	}
+	return nil
+}
+
+// parseServiceError converts client errors into upcloud.Error the same way upcloud-go-api does
+func parseServiceError(err error) error {
+	if clientError, ok := err.(*client.Error); ok {
+		serviceError := upcloud.Error{}
+		if json.Unmarshal(clientError.ResponseBody, &serviceError) == nil && serviceError.ErrorCode != "" {
+			return &serviceError
+		}
+	}
+	return err
+}
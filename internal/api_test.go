@@ -0,0 +1,181 @@
+package upcloud
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud/request"
+)
+
+func TestCreateServerRequest_MarshalJSON(t *testing.T) {
+	r := createServerRequest{
+		CreateServerRequest: request.CreateServerRequest{
+			Title: "packer-test",
+			Zone:  "nl-ams1",
+		},
+		Labels:   NewLabels(map[string]string{"b": "2", "a": "1"}),
+		NICModel: NICModelE1000,
+	}
+
+	data, err := json.Marshal(&r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result struct {
+		Server struct {
+			Title    string `json:"title"`
+			Zone     string `json:"zone"`
+			NICModel string `json:"nic_model"`
+			Labels   struct {
+				Label []Label `json:"label"`
+			} `json:"labels"`
+		} `json:"server"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Server.Title != "packer-test" || result.Server.Zone != "nl-ams1" || result.Server.NICModel != NICModelE1000 {
+		t.Errorf("Unexpected server: %s", data)
+	}
+
+	labels := result.Server.Labels.Label
+	if len(labels) != 2 || labels[0].Key != "a" || labels[1].Value != "2" {
+		t.Errorf("Unexpected labels: %s", data)
+	}
+}
+
+func TestCreateServerRequest_MarshalJSON_metadata(t *testing.T) {
+	for metadata, expected := range map[upcloud.Boolean]string{
+		upcloud.Empty: "",
+		upcloud.False: "",
+		upcloud.True:  "yes",
+	} {
+		r := createServerRequest{
+			CreateServerRequest: request.CreateServerRequest{
+				Metadata: metadata,
+			},
+		}
+
+		data, err := json.Marshal(&r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var result struct {
+			Server map[string]interface{} `json:"server"`
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			t.Fatal(err)
+		}
+
+		value, ok := result.Server["metadata"]
+		if expected == "" && ok {
+			t.Errorf("Expected no metadata for %s: %s", metadata.String(), data)
+		}
+		if expected != "" && value != expected {
+			t.Errorf("Expected metadata %q for %s: %s", expected, metadata.String(), data)
+		}
+	}
+}
+
+func TestModifyStorageLabelsRequest_MarshalJSON(t *testing.T) {
+	r := modifyStorageLabelsRequest{
+		UUID:   "some-uuid",
+		Labels: NewLabels(map[string]string{"packer-builder": "upcloud"}),
+	}
+
+	data, err := json.Marshal(&r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"storage":{"labels":[{"key":"packer-builder","value":"upcloud"}]}}`
+	if string(data) != expected {
+		t.Errorf("Expected: %s, got: %s", expected, data)
+	}
+
+	if r.RequestURL() != "/storage/some-uuid" {
+		t.Errorf("Unexpected request URL: %s", r.RequestURL())
+	}
+}
+
+func TestModifyServerLabelsRequest_MarshalJSON(t *testing.T) {
+	r := modifyServerLabelsRequest{
+		UUID:   "some-uuid",
+		Labels: NewLabels(map[string]string{"packer-expires-at": "2021-02-07T21:38:58Z"}),
+	}
+
+	data, err := json.Marshal(&r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"server":{"labels":{"label":[{"key":"packer-expires-at","value":"2021-02-07T21:38:58Z"}]}}}`
+	if string(data) != expected {
+		t.Errorf("Expected: %s, got: %s", expected, data)
+	}
+}
+
+func TestCreateServerRequest_MarshalJSON_storageEncryption(t *testing.T) {
+	r := createServerRequest{
+		CreateServerRequest: request.CreateServerRequest{
+			StorageDevices: []request.CreateServerStorageDevice{
+				{Action: request.CreateServerStorageDeviceActionClone, Storage: "disk-uuid"},
+				{Action: request.CreateServerStorageDeviceActionAttach, Storage: "cdrom-uuid", Type: "cdrom"},
+			},
+		},
+		StorageEncryption: true,
+	}
+
+	data, err := json.Marshal(&r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result struct {
+		Server struct {
+			StorageDevices struct {
+				StorageDevice []struct {
+					Storage   string `json:"storage"`
+					Encrypted string `json:"encrypted"`
+				} `json:"storage_device"`
+			} `json:"storage_devices"`
+		} `json:"server"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	devices := result.Server.StorageDevices.StorageDevice
+	if len(devices) != 2 || devices[0].Encrypted != "yes" || devices[1].Encrypted != "" {
+		t.Errorf("Unexpected storage devices: %s", data)
+	}
+}
+
+func TestCloneStorageRequest_MarshalJSON(t *testing.T) {
+	r := cloneStorageRequest{
+		CloneStorageRequest: request.CloneStorageRequest{
+			UUID:  "some-uuid",
+			Zone:  "fi-hel1",
+			Title: "clone",
+		},
+		Encrypted: upcloud.True,
+	}
+
+	data, err := json.Marshal(&r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"storage":{"zone":"fi-hel1","title":"clone","encrypted":"yes"}}`
+	if string(data) != expected {
+		t.Errorf("Expected: %s, got: %s", expected, data)
+	}
+
+	if r.RequestURL() != "/storage/some-uuid/clone" {
+		t.Errorf("Unexpected request URL: %s", r.RequestURL())
+	}
+}
@@ -2,6 +2,8 @@ package upcloud
 
 import (
 	"fmt"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -12,31 +14,84 @@ import (
 )
 
 const (
-	DefaultPlan = "1xCPU-2GB"
+	DefaultPlan       = "1xCPU-2GB"
+	DefaultPlanCores  = 1
+	DefaultPlanMemory = 2048
+
+	StorageNameMatchExact    = "exact"
+	StorageNameMatchContains = "contains"
+	StorageNameMatchRegex    = "regex"
+
+	NICModelE1000   = "e1000"
+	NICModelVirtio  = "virtio"
+	NICModelRTL8139 = "rtl8139"
+
+	StorageAddressVirtio = "virtio"
+	StorageAddressSCSI   = "scsi"
+	StorageAddressIDE    = "ide"
 )
 
 type (
 	Driver interface {
-		CreateServer(*ServerOpts) (*upcloud.ServerDetails, error)
+		CreateServer(*ServerOpts) (*ServerDetails, error)
 		DeleteServer(string) error
 		StopServer(string) error
-		GetStorage(string, string) (*upcloud.Storage, error)
+		EjectCDROM(string) error
+		DetachCDROM(string) error
+		WaitServerStopped(string, time.Duration) error
+		GetStorage(*StorageFilter) (*upcloud.Storage, error)
 		GetServerStorage(string) (*upcloud.ServerStorageDevice, error)
-		CloneStorage(string, string, string) (*upcloud.Storage, error)
+		CloneStorage(string, string, string, bool) (*upcloud.Storage, error)
+		IsStorageEncrypted(string) (bool, error)
 		CreateTemplate(string, string) (*upcloud.Storage, error)
 		DeleteTemplate(string) error
+		SetStorageLabels(string, map[string]string) error
+		SetServerLabels(string, map[string]string) error
+		GetStoragePrice(string, int) (float64, error)
+		GetPriceZone(string) (*upcloud.PriceZone, error)
+		GetAccountResources() (*AccountResources, error)
+		GetLeftovers(time.Duration, bool) ([]Leftover, error)
+		ValidateOnline(*OnlineValidationOpts) []error
+		CreateNetwork(*NetworkOpts) (*upcloud.Network, error)
+		DeleteNetwork(string) error
+		CreateRouter(string) (*upcloud.Router, error)
+		DeleteRouter(string) error
+		CreateNATGateway(string, string, string, map[string]string) (string, error)
+		DeleteNATGateway(string) error
+		SetFirewallRules(string, []upcloud.FirewallRule) error
+		DeleteFirewallRules(string) error
+		CreateFloatingIP(string) (*upcloud.IPAddress, error)
+		AttachFloatingIP(string, string) (*upcloud.IPAddress, error)
+		DetachFloatingIP(string) error
+		ReleaseFloatingIP(string) error
 	}
 
 	driver struct {
 		svc    *service.Service
+		client *client.Client
 		config *DriverConfig
 	}
 
 	DriverConfig struct {
-		Username    string
-		Password    string
-		Timeout     time.Duration
-		SSHUsername string
+		Username              string
+		Password              string
+		Timeout               time.Duration
+		ServerCreateTimeout   time.Duration
+		ServerStopTimeout     time.Duration
+		TemplateCreateTimeout time.Duration
+		CloneTimeout          time.Duration
+		ServerStopType        string
+		SSHUsername           string
+	}
+
+	// StorageFilter defines how the source storage is looked up
+	StorageFilter struct {
+		UUID       string
+		Name       string
+		Type       string
+		NameMatch  string
+		Access     string
+		MostRecent bool
 	}
 
 	ServerOpts struct {
@@ -46,6 +101,23 @@ type (
 		TemplatePrefix string
 		SshPublicKey   string
 		Networking     []request.CreateServerInterface
+		Labels         map[string]string
+		UserData       string
+		Metadata       bool
+		// LoginUser overrides the SSH username, CreatePassword generates a password
+		// for it instead of using the SSH key, e.g. for Windows servers
+		LoginUser      string
+		CreatePassword bool
+		// Virtual hardware of the server, empty values use the API defaults
+		NICModel       string
+		VideoModel     string
+		Timezone       string
+		BootOrder      string
+		Host           int
+		StorageAddress string
+		// CDROMUuid is attached as a CD-ROM device when set
+		CDROMUuid         string
+		StorageEncryption bool
 	}
 )
 
@@ -54,23 +126,33 @@ func NewDriver(c *DriverConfig) Driver {
 	svc := service.New(client)
 	return &driver{
 		svc:    svc,
+		client: client,
 		config: c,
 	}
 }
 
-func (d *driver) CreateServer(opts *ServerOpts) (*upcloud.ServerDetails, error) {
+func (d *driver) CreateServer(opts *ServerOpts) (*ServerDetails, error) {
 	// Create server
 	request := d.prepareCreateRequest(opts)
-	response, err := d.svc.CreateServer(request)
+	response, err := d.createServer(request)
 	if err != nil {
 		return nil, fmt.Errorf("Error creating server: %s", err)
 	}
 
 	// Wait for server to start
-	err = d.waitDesiredState(response.UUID, upcloud.ServerStateStarted)
+	err = d.waitDesiredState(response.UUID, upcloud.ServerStateStarted, d.config.ServerCreateTimeout)
 	if err != nil {
 		return nil, err
 	}
+
+	// Label server storages
+	if len(opts.Labels) > 0 {
+		for _, s := range response.StorageDevices {
+			if err := d.SetStorageLabels(s.UUID, opts.Labels); err != nil {
+				return nil, err
+			}
+		}
+	}
 	return response, nil
 }
 
@@ -82,7 +164,7 @@ func (d *driver) DeleteServer(serverUuid string) error {
 
 func (d *driver) StopServer(serverUuid string) error {
 	// Ensure the instance is not in maintenance state
-	err := d.waitUndesiredState(serverUuid, upcloud.ServerStateMaintenance)
+	err := d.waitUndesiredState(serverUuid, upcloud.ServerStateMaintenance, d.config.ServerStopTimeout)
 	if err != nil {
 		return err
 	}
@@ -97,25 +179,39 @@ func (d *driver) StopServer(serverUuid string) error {
 		return nil
 	}
 
+	stopType := d.config.ServerStopType
+	if stopType == "" {
+		stopType = upcloud.StopTypeSoft
+	}
+
 	// Stop server
-	_, err = d.svc.StopServer(&request.StopServerRequest{
-		UUID: serverUuid,
+	err = d.stopServer(serverUuid, stopType)
+	if err != nil && stopType == upcloud.StopTypeSoft {
+		// Fall back to hard stop if the server did not react to soft stop in time
+		err = d.stopServer(serverUuid, upcloud.StopTypeHard)
+	}
+	return err
+}
+
+func (d *driver) stopServer(serverUuid, stopType string) error {
+	_, err := d.svc.StopServer(&request.StopServerRequest{
+		UUID:     serverUuid,
+		StopType: stopType,
 	})
 	if err != nil {
 		return fmt.Errorf("Failed to stop server: %s", err)
 	}
 
 	// Wait for server to stop
-	err = d.waitDesiredState(serverUuid, upcloud.ServerStateStopped)
-	if err != nil {
-		return err
-	}
-	return nil
+	return d.waitDesiredState(serverUuid, upcloud.ServerStateStopped, d.config.ServerStopTimeout)
+}
+
+func (d *driver) WaitServerStopped(serverUuid string, timeout time.Duration) error {
+	return d.waitDesiredState(serverUuid, upcloud.ServerStateStopped, timeout)
 }
 
-func (d *driver) CreateTemplate(serverStorageUuid, prefix string) (*upcloud.Storage, error) {
+func (d *driver) CreateTemplate(serverStorageUuid, templateTitle string) (*upcloud.Storage, error) {
 	// create image
-	templateTitle := fmt.Sprintf("%s-%s", prefix, GetNowString())
 	response, err := d.svc.TemplatizeStorage(&request.TemplatizeStorageRequest{
 		UUID:  serverStorageUuid,
 		Title: templateTitle,
@@ -123,14 +219,14 @@ func (d *driver) CreateTemplate(serverStorageUuid, prefix string) (*upcloud.Stor
 	if err != nil {
 		return nil, fmt.Errorf("Error creating image: %s", err)
 	}
-	return d.waitStorageOnline(response.UUID)
+	return d.waitStorageOnline(response.UUID, d.config.TemplateCreateTimeout)
 }
 
-func (d *driver) waitStorageOnline(storageUuid string) (*upcloud.Storage, error) {
+func (d *driver) waitStorageOnline(storageUuid string, timeout time.Duration) (*upcloud.Storage, error) {
 	template, err := d.svc.WaitForStorageState(&request.WaitForStorageStateRequest{
 		UUID:         storageUuid,
 		DesiredState: upcloud.StorageStateOnline,
-		Timeout:      d.config.Timeout,
+		Timeout:      d.timeout(timeout),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("Error while waiting for storage to change state to 'online': %s", err)
@@ -139,19 +235,19 @@ func (d *driver) waitStorageOnline(storageUuid string) (*upcloud.Storage, error)
 }
 
 // fetch storage by uuid or name
-func (d *driver) GetStorage(storageUuid, storageName string) (*upcloud.Storage, error) {
-	if storageUuid != "" {
-		storage, err := d.getStorageByUuid(storageUuid)
+func (d *driver) GetStorage(filter *StorageFilter) (*upcloud.Storage, error) {
+	if filter.UUID != "" {
+		storage, err := d.getStorageByUuid(filter.UUID)
 		if err != nil {
-			return nil, fmt.Errorf("Error retrieving storage by uuid %q: %s", storageUuid, err)
+			return nil, fmt.Errorf("Error retrieving storage by uuid %q: %s", filter.UUID, err)
 		}
 		return storage, nil
 	}
 
-	if storageName != "" {
-		storage, err := d.getStorageByName(storageName)
+	if filter.Name != "" {
+		storage, err := d.getStorageByName(filter)
 		if err != nil {
-			return nil, fmt.Errorf("Error retrieving storage by name %q: %s", storageName, err)
+			return nil, fmt.Errorf("Error retrieving storage by name %q: %s", filter.Name, err)
 		}
 		return storage, nil
 
@@ -165,16 +261,113 @@ func (d *driver) DeleteTemplate(templateUuid string) error {
 	})
 }
 
-func (d *driver) CloneStorage(storageUuid string, zone string, title string) (*upcloud.Storage, error) {
-	response, err := d.svc.CloneStorage(&request.CloneStorageRequest{
-		UUID:  storageUuid,
-		Zone:  zone,
-		Title: title,
+func (d *driver) SetStorageLabels(storageUuid string, labels map[string]string) error {
+	err := d.modifyStorageLabels(&modifyStorageLabelsRequest{
+		UUID:   storageUuid,
+		Labels: NewLabels(labels),
 	})
+	if err != nil {
+		return fmt.Errorf("Error setting labels of storage %q: %s", storageUuid, err)
+	}
+	return nil
+}
+
+func (d *driver) EjectCDROM(serverUuid string) error {
+	_, err := d.svc.EjectCDROM(&request.EjectCDROMRequest{
+		ServerUUID: serverUuid,
+	})
+	if err != nil {
+		return fmt.Errorf("Error ejecting CD-ROM of server %q: %s", serverUuid, err)
+	}
+	return nil
+}
+
+// DetachCDROM detaches the CD-ROM devices of a stopped server, so that deleting
+// the server with its storages doesn't delete the loaded ISO
+func (d *driver) DetachCDROM(serverUuid string) error {
+	details, err := d.getServerDetails(serverUuid)
+	if err != nil {
+		return err
+	}
+
+	for _, device := range details.StorageDevices {
+		if device.Type != upcloud.StorageTypeCDROM {
+			continue
+		}
+		_, err := d.svc.DetachStorage(&request.DetachStorageRequest{
+			ServerUUID: serverUuid,
+			Address:    device.Address,
+		})
+		if err != nil {
+			return fmt.Errorf("Error detaching CD-ROM %q of server %q: %s", device.UUID, serverUuid, err)
+		}
+	}
+	return nil
+}
+
+func (d *driver) SetServerLabels(serverUuid string, labels map[string]string) error {
+	err := d.modifyServerLabels(&modifyServerLabelsRequest{
+		UUID:   serverUuid,
+		Labels: NewLabels(labels),
+	})
+	if err != nil {
+		return fmt.Errorf("Error setting labels of server %q: %s", serverUuid, err)
+	}
+	return nil
+}
+
+// GetStoragePrice returns the hourly price of a MaxIOPS storage of the given size in the zone
+func (d *driver) GetStoragePrice(zone string, size int) (float64, error) {
+	priceZone, err := d.GetPriceZone(zone)
+	if err != nil {
+		return 0, err
+	}
+
+	if priceZone.StorageMaxIOPS == nil || priceZone.StorageMaxIOPS.Amount == 0 {
+		return 0, fmt.Errorf("Storage price for zone %q not found", zone)
+	}
+	return priceZone.StorageMaxIOPS.Price * float64(size) / float64(priceZone.StorageMaxIOPS.Amount), nil
+}
+
+func (d *driver) GetPriceZone(zone string) (*upcloud.PriceZone, error) {
+	response, err := d.svc.GetPriceZones()
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching prices: %s", err)
+	}
+
+	for _, z := range response.PriceZones {
+		if z.Name == zone {
+			return &z, nil
+		}
+	}
+	return nil, fmt.Errorf("Prices for zone %q not found", zone)
+}
+
+func (d *driver) CloneStorage(storageUuid string, zone string, title string, encrypted bool) (*upcloud.Storage, error) {
+	r := &cloneStorageRequest{
+		CloneStorageRequest: request.CloneStorageRequest{
+			UUID:  storageUuid,
+			Zone:  zone,
+			Title: title,
+		},
+	}
+	if encrypted {
+		r.Encrypted = upcloud.True
+	}
+
+	response, err := d.cloneStorage(r)
 	if err != nil {
 		return nil, err
 	}
-	return d.waitStorageOnline(response.UUID)
+	return d.waitStorageOnline(response.UUID, d.config.CloneTimeout)
+}
+
+func (d *driver) IsStorageEncrypted(storageUuid string) (bool, error) {
+	encrypted, err := d.getStorageEncrypted(storageUuid)
+	if err != nil {
+		return false, fmt.Errorf("Error fetching encryption of storage %q: %s", storageUuid, err)
+	}
+	return encrypted, nil
 }
 
 func (d *driver) getStorageByUuid(storageUuid string) (*upcloud.Storage, error) {
@@ -188,36 +381,100 @@ func (d *driver) getStorageByUuid(storageUuid string) (*upcloud.Storage, error)
 	return &response.Storage, nil
 }
 
-func (d *driver) getStorageByName(storageName string) (*upcloud.Storage, error) {
+func (d *driver) getStorageByName(filter *StorageFilter) (*upcloud.Storage, error) {
+	storageType := filter.Type
+	if storageType == "" {
+		storageType = upcloud.StorageTypeTemplate
+	}
+
+	// public and private storages of the type
 	response, err := d.svc.GetStorages(&request.GetStoragesRequest{
-		Type: upcloud.StorageTypeTemplate,
+		Type: storageType,
 	})
 
 	if err != nil {
 		return nil, fmt.Errorf("Error fetching storages: %s", err)
 	}
+	return selectStorage(response.Storages, filter)
+}
 
-	var found bool
-	var storage upcloud.Storage
-	for _, s := range response.Storages {
-		if strings.Contains(strings.ToLower(s.Title), strings.ToLower(storageName)) {
-			found = true
-			storage = s
-			break
+// ValidateSourceStorage checks that the storage can be used as the source of the build server
+func ValidateSourceStorage(storage *upcloud.Storage) error {
+	switch storage.Type {
+	case upcloud.StorageTypeTemplate, upcloud.StorageTypeNormal, upcloud.StorageTypeBackup:
+	default:
+		return fmt.Errorf("Storage %q is of type %q, only %q, %q and %q storages can be used as source",
+			storage.UUID, storage.Type, upcloud.StorageTypeTemplate, upcloud.StorageTypeNormal, upcloud.StorageTypeBackup)
+	}
+
+	if storage.State != upcloud.StorageStateOnline {
+		return fmt.Errorf("Storage %q is in %q state, it must be %q to be used as source",
+			storage.UUID, storage.State, upcloud.StorageStateOnline)
+	}
+	return nil
+}
+
+// selectStorage picks the storage matching the filter, failing if there is no or more than one candidate
+func selectStorage(storages []upcloud.Storage, filter *StorageFilter) (*upcloud.Storage, error) {
+	var re *regexp.Regexp
+	if filter.NameMatch == StorageNameMatchRegex {
+		var err error
+		re, err = regexp.Compile(filter.Name)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid storage name regex: %s", err)
 		}
 	}
 
-	if !found {
-		return nil, fmt.Errorf("Failed to find storage by name %q", storageName)
+	candidates := []upcloud.Storage{}
+	for _, s := range storages {
+		if filter.Access != "" && s.Access != filter.Access {
+			continue
+		}
+
+		var match bool
+		switch filter.NameMatch {
+		case StorageNameMatchExact:
+			match = s.Title == filter.Name
+		case StorageNameMatchRegex:
+			match = re.MatchString(s.Title)
+		default:
+			match = strings.Contains(strings.ToLower(s.Title), strings.ToLower(filter.Name))
+		}
+
+		if match {
+			candidates = append(candidates, s)
+		}
 	}
-	return &storage, nil
+
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("Failed to find storage by name %q", filter.Name)
+	}
+
+	if len(candidates) > 1 && filter.MostRecent {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].Created.After(candidates[j].Created)
+		})
+		if candidates[0].Created.After(candidates[1].Created) {
+			return &candidates[0], nil
+		}
+	}
+
+	if len(candidates) > 1 {
+		titles := []string{}
+		for _, c := range candidates {
+			titles = append(titles, fmt.Sprintf("%q (%s)", c.Title, c.UUID))
+		}
+		return nil, fmt.Errorf("Found %d storages matching name %q, use a more specific name or 'storage_uuid': %s",
+			len(candidates), filter.Name, strings.Join(titles, ", "))
+	}
+	return &candidates[0], nil
 }
 
-func (d *driver) waitDesiredState(serverUuid string, state string) error {
+func (d *driver) waitDesiredState(serverUuid string, state string, timeout time.Duration) error {
 	request := &request.WaitForServerStateRequest{
 		UUID:         serverUuid,
 		DesiredState: state,
-		Timeout:      d.config.Timeout,
+		Timeout:      d.timeout(timeout),
 	}
 	if _, err := d.svc.WaitForServerState(request); err != nil {
 		return fmt.Errorf("Error while waiting for server to change state to %q: %s", state, err)
@@ -225,11 +482,11 @@ func (d *driver) waitDesiredState(serverUuid string, state string) error {
 	return nil
 }
 
-func (d *driver) waitUndesiredState(serverUuid string, state string) error {
+func (d *driver) waitUndesiredState(serverUuid string, state string, timeout time.Duration) error {
 	request := &request.WaitForServerStateRequest{
 		UUID:           serverUuid,
 		UndesiredState: state,
-		Timeout:        d.config.Timeout,
+		Timeout:        d.timeout(timeout),
 	}
 	if _, err := d.svc.WaitForServerState(request); err != nil {
 		return fmt.Errorf("Error while waiting for server to change state from %q: %s", state, err)
@@ -237,6 +494,14 @@ func (d *driver) waitUndesiredState(serverUuid string, state string) error {
 	return nil
 }
 
+// timeout returns the given operation specific timeout or the global one if not set
+func (d *driver) timeout(timeout time.Duration) time.Duration {
+	if timeout == 0 {
+		return d.config.Timeout
+	}
+	return timeout
+}
+
 func (d *driver) getServerDetails(serverUuid string) (*upcloud.ServerDetails, error) {
 	response, err := d.svc.GetServerDetails(&request.GetServerDetailsRequest{
 		UUID: serverUuid,
@@ -268,34 +533,74 @@ func (d *driver) GetServerStorage(serverUuid string) (*upcloud.ServerStorageDevi
 	return &storage, nil
 }
 
-func (d *driver) prepareCreateRequest(opts *ServerOpts) *request.CreateServerRequest {
+func (d *driver) prepareCreateRequest(opts *ServerOpts) *createServerRequest {
 	title := fmt.Sprintf("packer-%s-%s", opts.TemplatePrefix, GetNowString())
 	hostname := opts.TemplatePrefix
 	titleDisk := fmt.Sprintf("%s-disk1", title)
 
+	username := opts.LoginUser
+	if username == "" {
+		username = d.config.SSHUsername
+	}
+
+	var loginUser *request.LoginUser
+	if opts.CreatePassword {
+		loginUser = &request.LoginUser{
+			CreatePassword: "yes",
+			Username:       username,
+		}
+	} else {
+		loginUser = &request.LoginUser{
+			CreatePassword: "no",
+			Username:       username,
+			SSHKeys:        []string{opts.SshPublicKey},
+		}
+	}
+
+	storageDevices := []request.CreateServerStorageDevice{
+		{
+			Action:  request.CreateServerStorageDeviceActionClone,
+			Address: opts.StorageAddress,
+			Storage: opts.StorageUuid,
+			Title:   titleDisk,
+			Size:    opts.StorageSize,
+			Tier:    upcloud.StorageTierMaxIOPS,
+		},
+	}
+	if opts.CDROMUuid != "" {
+		storageDevices = append(storageDevices, request.CreateServerStorageDevice{
+			Action:  request.CreateServerStorageDeviceActionAttach,
+			Storage: opts.CDROMUuid,
+			Type:    upcloud.StorageTypeCDROM,
+		})
+	}
+
 	request := request.CreateServerRequest{
 		Title:            title,
 		Hostname:         hostname,
 		Zone:             opts.Zone,
 		PasswordDelivery: request.PasswordDeliveryNone,
 		Plan:             DefaultPlan,
-		StorageDevices: []request.CreateServerStorageDevice{
-			{
-				Action:  request.CreateServerStorageDeviceActionClone,
-				Storage: opts.StorageUuid,
-				Title:   titleDisk,
-				Size:    opts.StorageSize,
-				Tier:    upcloud.StorageTierMaxIOPS,
-			},
-		},
+		UserData:         opts.UserData,
+		VideoModel:       opts.VideoModel,
+		TimeZone:         opts.Timezone,
+		BootOrder:        opts.BootOrder,
+		Host:             opts.Host,
+		StorageDevices:   storageDevices,
 		Networking: &request.CreateServerNetworking{
 			Interfaces: opts.Networking,
 		},
-		LoginUser: &request.LoginUser{
-			CreatePassword: "no",
-			Username:       d.config.SSHUsername,
-			SSHKeys:        []string{opts.SshPublicKey},
-		},
+		LoginUser: loginUser,
+	}
+
+	if opts.Metadata {
+		request.Metadata = upcloud.True
+	}
+
+	return &createServerRequest{
+		CreateServerRequest: request,
+		Labels:              NewLabels(opts.Labels),
+		NICModel:            opts.NICModel,
+		StorageEncryption:   opts.StorageEncryption,
 	}
-	return &request
 }
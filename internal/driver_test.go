@@ -0,0 +1,129 @@
+package upcloud
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
+)
+
+var testStorages = []upcloud.Storage{
+	{UUID: "uuid-1", Title: "Ubuntu Server 18.04 LTS (Bionic Beaver)", Access: upcloud.StorageAccessPublic},
+	{UUID: "uuid-2", Title: "Ubuntu Server 20.04 LTS (Focal Fossa)", Access: upcloud.StorageAccessPublic},
+	{UUID: "uuid-3", Title: "app-ubuntu-1", Access: upcloud.StorageAccessPrivate, Created: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+	{UUID: "uuid-4", Title: "app-ubuntu-2", Access: upcloud.StorageAccessPrivate, Created: time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)},
+}
+
+func TestSelectStorage(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   StorageFilter
+		expected string
+	}{
+		{"contains", StorageFilter{Name: "ubuntu server 20.04", NameMatch: StorageNameMatchContains}, "uuid-2"},
+		{"exact", StorageFilter{Name: "app-ubuntu-1", NameMatch: StorageNameMatchExact}, "uuid-3"},
+		{"regex", StorageFilter{Name: `^Ubuntu Server 18\.04`, NameMatch: StorageNameMatchRegex}, "uuid-1"},
+		{"access", StorageFilter{Name: "ubuntu", NameMatch: StorageNameMatchContains, Access: upcloud.StorageAccessPrivate, MostRecent: true}, "uuid-4"},
+		{"most recent", StorageFilter{Name: "^app-", NameMatch: StorageNameMatchRegex, MostRecent: true}, "uuid-4"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			storage, err := selectStorage(testStorages, &test.filter)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if storage.UUID != test.expected {
+				t.Errorf("Expected: %q, got: %q", test.expected, storage.UUID)
+			}
+		})
+	}
+}
+
+func TestSelectStorage_errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   StorageFilter
+		expected string
+	}{
+		{"not found", StorageFilter{Name: "debian", NameMatch: StorageNameMatchContains}, "Failed to find storage"},
+		{"ambiguous", StorageFilter{Name: "ubuntu server", NameMatch: StorageNameMatchContains}, "uuid-1"},
+		{"ambiguous most recent", StorageFilter{Name: "ubuntu server", NameMatch: StorageNameMatchContains, MostRecent: true}, "Found 2 storages"},
+		{"exact", StorageFilter{Name: "app-ubuntu", NameMatch: StorageNameMatchExact}, "Failed to find storage"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := selectStorage(testStorages, &test.filter)
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("Expected error containing %q, got: %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestValidateSourceStorage(t *testing.T) {
+	valid := []upcloud.Storage{
+		{Type: upcloud.StorageTypeTemplate, State: upcloud.StorageStateOnline},
+		{Type: upcloud.StorageTypeNormal, State: upcloud.StorageStateOnline},
+		{Type: upcloud.StorageTypeBackup, State: upcloud.StorageStateOnline},
+	}
+	for _, s := range valid {
+		if err := ValidateSourceStorage(&s); err != nil {
+			t.Errorf("Unexpected error for %q storage: %s", s.Type, err)
+		}
+	}
+
+	invalid := []upcloud.Storage{
+		{Type: upcloud.StorageTypeCDROM, State: upcloud.StorageStateOnline},
+		{Type: upcloud.StorageTypeNormal, State: upcloud.StorageStateMaintenance},
+	}
+	for _, s := range invalid {
+		if err := ValidateSourceStorage(&s); err == nil {
+			t.Errorf("Expected error for %q storage in %q state", s.Type, s.State)
+		}
+	}
+}
+
+func TestPrepareCreateRequest_hardware(t *testing.T) {
+	d := &driver{config: &DriverConfig{SSHUsername: "root"}}
+	r := d.prepareCreateRequest(&ServerOpts{
+		StorageUuid:    "storage-uuid",
+		Zone:           "nl-ams1",
+		NICModel:       NICModelE1000,
+		VideoModel:     upcloud.VideoModelCirrus,
+		Timezone:       "Europe/Helsinki",
+		BootOrder:      "cdrom,disk",
+		Host:           1234,
+		StorageAddress: StorageAddressIDE,
+	})
+
+	if r.NICModel != NICModelE1000 || r.VideoModel != upcloud.VideoModelCirrus || r.TimeZone != "Europe/Helsinki" {
+		t.Errorf("Unexpected hardware: %+v", r)
+	}
+	if r.BootOrder != "cdrom,disk" || r.Host != 1234 {
+		t.Errorf("Unexpected boot order or host: %+v", r)
+	}
+	if r.StorageDevices[0].Address != StorageAddressIDE {
+		t.Errorf("Expected storage address %q, got: %q", StorageAddressIDE, r.StorageDevices[0].Address)
+	}
+}
+
+func TestPrepareCreateRequest_cdrom(t *testing.T) {
+	d := &driver{config: &DriverConfig{SSHUsername: "root"}}
+
+	r := d.prepareCreateRequest(&ServerOpts{StorageUuid: "storage-uuid"})
+	if len(r.StorageDevices) != 1 {
+		t.Fatalf("Expected only the disk, got: %+v", r.StorageDevices)
+	}
+
+	r = d.prepareCreateRequest(&ServerOpts{StorageUuid: "storage-uuid", CDROMUuid: "cdrom-uuid"})
+	if len(r.StorageDevices) != 2 {
+		t.Fatalf("Expected disk and CD-ROM, got: %+v", r.StorageDevices)
+	}
+	cdrom := r.StorageDevices[1]
+	if cdrom.Storage != "cdrom-uuid" || cdrom.Type != upcloud.StorageTypeCDROM || cdrom.Action != "attach" {
+		t.Errorf("Unexpected CD-ROM device: %+v", cdrom)
+	}
+}
@@ -0,0 +1,181 @@
+package upcloud
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud/request"
+)
+
+const (
+	// PublicIPServiceURL returns the public IPv4 address of the caller as plain text
+	PublicIPServiceURL = "https://api.ipify.org"
+
+	// inbound replies to outbound connections arrive at the ephemeral ports of the server
+	ephemeralPortStart = 32768
+	ephemeralPortEnd   = 65535
+
+	firewallOn  = "on"
+	firewallOff = "off"
+)
+
+// GetPublicIP detects the public IPv4 address of the host running Packer
+func GetPublicIP() (string, error) {
+	client := http.Client{Timeout: 10 * time.Second}
+	response, err := client.Get(PublicIPServiceURL)
+	if err != nil {
+		return "", fmt.Errorf("Error detecting public IP address: %s", err)
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return "", fmt.Errorf("Error detecting public IP address: %s", err)
+	}
+
+	ip := net.ParseIP(strings.TrimSpace(string(body)))
+	if response.StatusCode != http.StatusOK || ip == nil {
+		return "", fmt.Errorf("Error detecting public IP address: unexpected response %q", response.Status)
+	}
+	return ip.String(), nil
+}
+
+// FirewallRules returns rules allowing the communicator port only from the given networks,
+// replies to outbound traffic, ICMP and DHCP, and dropping all other inbound traffic
+func FirewallRules(allowed []*net.IPNet, port int) []upcloud.FirewallRule {
+	rules := []upcloud.FirewallRule{}
+	for _, n := range allowed {
+		start, end := addressRange(n)
+		rules = append(rules, upcloud.FirewallRule{
+			Action:               upcloud.FirewallRuleActionAccept,
+			Comment:              "Packer communicator",
+			Direction:            upcloud.FirewallRuleDirectionIn,
+			Family:               addressFamily(n.IP),
+			Protocol:             upcloud.FirewallRuleProtocolTCP,
+			SourceAddressStart:   start,
+			SourceAddressEnd:     end,
+			DestinationPortStart: strconv.Itoa(port),
+			DestinationPortEnd:   strconv.Itoa(port),
+		})
+	}
+
+	dhcpPorts := map[string]string{
+		upcloud.IPAddressFamilyIPv4: "68",
+		upcloud.IPAddressFamilyIPv6: "546",
+	}
+	for _, family := range []string{upcloud.IPAddressFamilyIPv4, upcloud.IPAddressFamilyIPv6} {
+		for _, protocol := range []string{upcloud.FirewallRuleProtocolTCP, upcloud.FirewallRuleProtocolUDP} {
+			rules = append(rules, upcloud.FirewallRule{
+				Action:               upcloud.FirewallRuleActionAccept,
+				Comment:              "Replies to outbound traffic",
+				Direction:            upcloud.FirewallRuleDirectionIn,
+				Family:               family,
+				Protocol:             protocol,
+				DestinationPortStart: strconv.Itoa(ephemeralPortStart),
+				DestinationPortEnd:   strconv.Itoa(ephemeralPortEnd),
+			})
+		}
+		rules = append(rules,
+			upcloud.FirewallRule{
+				Action:               upcloud.FirewallRuleActionAccept,
+				Comment:              "DHCP",
+				Direction:            upcloud.FirewallRuleDirectionIn,
+				Family:               family,
+				Protocol:             upcloud.FirewallRuleProtocolUDP,
+				DestinationPortStart: dhcpPorts[family],
+				DestinationPortEnd:   dhcpPorts[family],
+			},
+			upcloud.FirewallRule{
+				Action:    upcloud.FirewallRuleActionAccept,
+				Comment:   "ICMP",
+				Direction: upcloud.FirewallRuleDirectionIn,
+				Family:    family,
+				Protocol:  upcloud.FirewallRuleProtocolICMP,
+			},
+			upcloud.FirewallRule{
+				Action:    upcloud.FirewallRuleActionDrop,
+				Direction: upcloud.FirewallRuleDirectionIn,
+				Family:    family,
+			},
+			upcloud.FirewallRule{
+				Action:    upcloud.FirewallRuleActionAccept,
+				Direction: upcloud.FirewallRuleDirectionOut,
+				Family:    family,
+			},
+		)
+	}
+
+	for i := range rules {
+		rules[i].Position = i + 1
+	}
+	return rules
+}
+
+// addressRange returns the first and the last address of the network
+func addressRange(n *net.IPNet) (string, string) {
+	ip := n.IP.Mask(n.Mask)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	last := make(net.IP, len(ip))
+	for i := range ip {
+		last[i] = ip[i] | ^n.Mask[len(n.Mask)-len(ip)+i]
+	}
+	return ip.String(), last.String()
+}
+
+func addressFamily(ip net.IP) string {
+	if ip.To4() != nil {
+		return upcloud.IPAddressFamilyIPv4
+	}
+	return upcloud.IPAddressFamilyIPv6
+}
+
+// SetFirewallRules replaces the firewall rules of the server and enables the firewall
+func (d *driver) SetFirewallRules(serverUuid string, rules []upcloud.FirewallRule) error {
+	err := d.svc.CreateFirewallRules(&request.CreateFirewallRulesRequest{
+		ServerUUID:    serverUuid,
+		FirewallRules: rules,
+	})
+	if err != nil {
+		return fmt.Errorf("Error creating firewall rules of server %q: %s", serverUuid, err)
+	}
+
+	if err := d.modifyServerFirewall(serverUuid, firewallOn); err != nil {
+		return fmt.Errorf("Error enabling firewall of server %q: %s", serverUuid, err)
+	}
+	return nil
+}
+
+// DeleteFirewallRules disables the firewall of the server and removes all of its rules
+func (d *driver) DeleteFirewallRules(serverUuid string) error {
+	if err := d.modifyServerFirewall(serverUuid, firewallOff); err != nil {
+		return fmt.Errorf("Error disabling firewall of server %q: %s", serverUuid, err)
+	}
+
+	rules, err := d.svc.GetFirewallRules(&request.GetFirewallRulesRequest{
+		ServerUUID: serverUuid,
+	})
+	if err != nil {
+		return fmt.Errorf("Error fetching firewall rules of server %q: %s", serverUuid, err)
+	}
+
+	// positions of the remaining rules change after each deletion
+	for i := len(rules.FirewallRules); i > 0; i-- {
+		err := d.svc.DeleteFirewallRule(&request.DeleteFirewallRuleRequest{
+			ServerUUID: serverUuid,
+			Position:   i,
+		})
+		if err != nil {
+			return fmt.Errorf("Error deleting firewall rule %d of server %q: %s", i, serverUuid, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package upcloud
+
+import (
+	"net"
+	"testing"
+
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
+)
+
+func TestAddressRange(t *testing.T) {
+	tests := map[string][2]string{
+		"203.0.113.7/32":  {"203.0.113.7", "203.0.113.7"},
+		"198.51.100.0/24": {"198.51.100.0", "198.51.100.255"},
+		"2001:db8::/64":   {"2001:db8::", "2001:db8::ffff:ffff:ffff:ffff"},
+	}
+
+	for cidr, expected := range tests {
+		_, n, _ := net.ParseCIDR(cidr)
+		start, end := addressRange(n)
+		if start != expected[0] || end != expected[1] {
+			t.Errorf("Expected %s-%s for %s, got %s-%s", expected[0], expected[1], cidr, start, end)
+		}
+	}
+}
+
+func TestFirewallRules(t *testing.T) {
+	_, ipv4, _ := net.ParseCIDR("203.0.113.7/32")
+	_, ipv6, _ := net.ParseCIDR("2001:db8::/64")
+
+	rules := FirewallRules([]*net.IPNet{ipv4, ipv6}, 22)
+
+	first := rules[0]
+	if first.Family != upcloud.IPAddressFamilyIPv4 || first.SourceAddressStart != "203.0.113.7" || first.DestinationPortStart != "22" {
+		t.Errorf("Unexpected first rule: %+v", first)
+	}
+	if rules[1].Family != upcloud.IPAddressFamilyIPv6 {
+		t.Errorf("Unexpected second rule: %+v", rules[1])
+	}
+
+	drops := 0
+	for i, r := range rules {
+		if r.Position != i+1 {
+			t.Errorf("Expected position %d, got %d", i+1, r.Position)
+		}
+		if r.Action == upcloud.FirewallRuleActionDrop {
+			drops++
+			if r.Direction != upcloud.FirewallRuleDirectionIn {
+				t.Errorf("Unexpected outbound drop rule: %+v", r)
+			}
+		}
+	}
+	if drops != 2 {
+		t.Errorf("Expected a drop rule for both families, got %d", drops)
+	}
+}
@@ -0,0 +1,120 @@
+package upcloud
+
+import (
+	"fmt"
+
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud/request"
+)
+
+// CreateFloatingIP allocates a new floating IPv4 address to the public interface of the server
+func (d *driver) CreateFloatingIP(serverUuid string) (*upcloud.IPAddress, error) {
+	mac, err := d.publicInterfaceMAC(serverUuid)
+	if err != nil {
+		return nil, err
+	}
+
+	ip, err := d.svc.AssignIPAddress(&request.AssignIPAddressRequest{
+		Family:   upcloud.IPAddressFamilyIPv4,
+		Floating: upcloud.True,
+		MAC:      mac,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error creating floating IP: %s", err)
+	}
+	return ip, nil
+}
+
+// AttachFloatingIP attaches an existing floating IP address to the public interface of the server
+func (d *driver) AttachFloatingIP(serverUuid, address string) (*upcloud.IPAddress, error) {
+	details, err := d.getServerDetails(serverUuid)
+	if err != nil {
+		return nil, err
+	}
+
+	mac, err := PublicInterfaceMAC(details)
+	if err != nil {
+		return nil, err
+	}
+
+	ip, err := d.svc.GetIPAddressDetails(&request.GetIPAddressDetailsRequest{
+		Address: address,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching floating IP %q: %s", address, err)
+	}
+
+	if err := checkFloatingIP(ip, details.Zone); err != nil {
+		return nil, err
+	}
+
+	ip, err = d.svc.ModifyIPAddress(&request.ModifyIPAddressRequest{
+		IPAddress: address,
+		MAC:       mac,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error attaching floating IP %q: %s", address, err)
+	}
+	return ip, nil
+}
+
+// DetachFloatingIP detaches the floating IP address from the server it is attached to
+func (d *driver) DetachFloatingIP(address string) error {
+	// ModifyIPAddressRequest without MAC sends "mac": null
+	_, err := d.svc.ModifyIPAddress(&request.ModifyIPAddressRequest{
+		IPAddress: address,
+	})
+	if err != nil {
+		return fmt.Errorf("Error detaching floating IP %q: %s", address, err)
+	}
+	return nil
+}
+
+// ReleaseFloatingIP deletes the floating IP address from the account
+func (d *driver) ReleaseFloatingIP(address string) error {
+	err := d.svc.ReleaseIPAddress(&request.ReleaseIPAddressRequest{
+		IPAddress: address,
+	})
+	if err != nil {
+		return fmt.Errorf("Error releasing floating IP %q: %s", address, err)
+	}
+	return nil
+}
+
+func (d *driver) publicInterfaceMAC(serverUuid string) (string, error) {
+	details, err := d.getServerDetails(serverUuid)
+	if err != nil {
+		return "", err
+	}
+	return PublicInterfaceMAC(details)
+}
+
+// PublicInterfaceMAC returns the MAC address of the first public interface with an IPv4 address,
+// which floating IPs are attached to
+func PublicInterfaceMAC(details *upcloud.ServerDetails) (string, error) {
+	for _, iface := range details.Networking.Interfaces {
+		if iface.Type != upcloud.IPAddressAccessPublic || iface.MAC == "" {
+			continue
+		}
+		for _, ip := range iface.IPAddresses {
+			if ip.Family == upcloud.IPAddressFamilyIPv4 {
+				return iface.MAC, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("Server %q has no public IPv4 interface for the floating IP", details.UUID)
+}
+
+// checkFloatingIP verifies that the address is a free floating IP in the zone of the server
+func checkFloatingIP(ip *upcloud.IPAddress, zone string) error {
+	if !ip.Floating.Bool() {
+		return fmt.Errorf("IP address %q is not a floating IP", ip.Address)
+	}
+	if ip.Zone != "" && ip.Zone != zone {
+		return fmt.Errorf("Floating IP %q is located in %q, expected %q", ip.Address, ip.Zone, zone)
+	}
+	if ip.ServerUUID != "" || ip.MAC != "" {
+		return fmt.Errorf("Floating IP %q is attached to server %q, detach it first", ip.Address, ip.ServerUUID)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package upcloud
+
+import (
+	"testing"
+
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
+)
+
+func TestPublicInterfaceMAC(t *testing.T) {
+	details := &upcloud.ServerDetails{}
+	details.Networking.Interfaces = upcloud.ServerInterfaceSlice{
+		{Type: upcloud.IPAddressAccessPrivate, MAC: "mac-private", IPAddresses: upcloud.IPAddressSlice{{Family: upcloud.IPAddressFamilyIPv4}}},
+		{Type: upcloud.IPAddressAccessPublic, MAC: "mac-ipv6", IPAddresses: upcloud.IPAddressSlice{{Family: upcloud.IPAddressFamilyIPv6}}},
+		{Type: upcloud.IPAddressAccessPublic, MAC: "mac-ipv4", IPAddresses: upcloud.IPAddressSlice{{Family: upcloud.IPAddressFamilyIPv4}}},
+	}
+
+	mac, err := PublicInterfaceMAC(details)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if mac != "mac-ipv4" {
+		t.Errorf("Expected %q, got: %q", "mac-ipv4", mac)
+	}
+
+	details.Networking.Interfaces = details.Networking.Interfaces[:2]
+	if _, err := PublicInterfaceMAC(details); err == nil {
+		t.Error("Expected an error without public IPv4 interface")
+	}
+}
+
+func TestCheckFloatingIP(t *testing.T) {
+	ip := &upcloud.IPAddress{Address: "198.51.100.7", Floating: upcloud.True, Zone: "fi-hel1"}
+
+	if err := checkFloatingIP(ip, "fi-hel1"); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if err := checkFloatingIP(ip, "nl-ams1"); err == nil {
+		t.Error("Expected an error for floating IP in another zone")
+	}
+
+	ip.MAC = "mac-1"
+	if err := checkFloatingIP(ip, "fi-hel1"); err == nil {
+		t.Error("Expected an error for attached floating IP")
+	}
+
+	ip.MAC = ""
+	ip.Floating = upcloud.False
+	if err := checkFloatingIP(ip, "fi-hel1"); err == nil {
+		t.Error("Expected an error for non-floating IP")
+	}
+}
@@ -0,0 +1,133 @@
+package upcloud
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud/request"
+)
+
+const (
+	gatewayFeatureNAT     = "nat"
+	gatewayStateRunning   = "running"
+	gatewayPollInterval   = 5 * time.Second
+	networkDeleteAttempts = 12
+	networkDeleteInterval = 5 * time.Second
+)
+
+// NetworkOpts defines the temporary private network of the build
+type NetworkOpts struct {
+	Name   string
+	Zone   string
+	CIDR   string
+	Router string
+}
+
+// CreateNetwork creates a private network with DHCP, the default route is only announced when a router is given
+func (d *driver) CreateNetwork(opts *NetworkOpts) (*upcloud.Network, error) {
+	network, err := d.svc.CreateNetwork(&request.CreateNetworkRequest{
+		Name:   opts.Name,
+		Zone:   opts.Zone,
+		Router: opts.Router,
+		IPNetworks: upcloud.IPNetworkSlice{
+			{
+				Address:          opts.CIDR,
+				DHCP:             upcloud.True,
+				DHCPDefaultRoute: upcloud.FromBool(opts.Router != ""),
+				Family:           upcloud.IPAddressFamilyIPv4,
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error creating network: %s", err)
+	}
+	return network, nil
+}
+
+// DeleteNetwork deletes a network once the interfaces of deleted servers are detached
+func (d *driver) DeleteNetwork(networkUuid string) error {
+	err := retryDelete(func() error {
+		return d.svc.DeleteNetwork(&request.DeleteNetworkRequest{
+			UUID: networkUuid,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("Error deleting network %q: %s", networkUuid, err)
+	}
+	return nil
+}
+
+func (d *driver) CreateRouter(name string) (*upcloud.Router, error) {
+	router, err := d.svc.CreateRouter(&request.CreateRouterRequest{
+		Name: name,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error creating router: %s", err)
+	}
+	return router, nil
+}
+
+// DeleteRouter deletes a router once its networks and gateways are deleted
+func (d *driver) DeleteRouter(routerUuid string) error {
+	err := retryDelete(func() error {
+		return d.svc.DeleteRouter(&request.DeleteRouterRequest{
+			UUID: routerUuid,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("Error deleting router %q: %s", routerUuid, err)
+	}
+	return nil
+}
+
+// CreateNATGateway creates a NAT gateway for the networks attached to the router and waits until it is running
+func (d *driver) CreateNATGateway(name, zone, routerUuid string, labels map[string]string) (string, error) {
+	gw, err := d.createGateway(&createGatewayRequest{
+		Name:     name,
+		Zone:     zone,
+		Features: []string{gatewayFeatureNAT},
+		Routers:  []gatewayRouter{{UUID: routerUuid}},
+		Labels:   NewLabels(labels),
+	})
+	if err != nil {
+		return "", fmt.Errorf("Error creating NAT gateway: %s", err)
+	}
+
+	// the gateway is not a server, so 'server_create_timeout' doesn't apply
+	deadline := time.Now().Add(d.config.Timeout)
+	for gw.OperationalState != gatewayStateRunning {
+		if time.Now().After(deadline) {
+			return gw.UUID, fmt.Errorf("Timeout while waiting for NAT gateway %q to start", gw.UUID)
+		}
+		time.Sleep(gatewayPollInterval)
+
+		current, err := d.getGateway(gw.UUID)
+		if err != nil {
+			return gw.UUID, fmt.Errorf("Error fetching NAT gateway: %s", err)
+		}
+		gw = current
+	}
+	return gw.UUID, nil
+}
+
+func (d *driver) DeleteNATGateway(gatewayUuid string) error {
+	if err := d.deleteGateway(gatewayUuid); err != nil {
+		return fmt.Errorf("Error deleting NAT gateway %q: %s", gatewayUuid, err)
+	}
+	return nil
+}
+
+// retryDelete retries a deletion rejected while dependent resources are still being removed
+func retryDelete(del func() error) error {
+	var err error
+	for i := 0; i < networkDeleteAttempts; i++ {
+		if err = del(); err == nil {
+			return nil
+		}
+		if i < networkDeleteAttempts-1 {
+			time.Sleep(networkDeleteInterval)
+		}
+	}
+	return err
+}
@@ -0,0 +1,116 @@
+package upcloud
+
+import (
+	"fmt"
+
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud/request"
+)
+
+type (
+	// Resources is an amount of account resources, memory in megabytes and storage in gigabytes
+	Resources struct {
+		Cores      int
+		Memory     int
+		PublicIPv4 int
+		StorageSSD int
+		StorageHDD int
+	}
+
+	// AccountResources holds the resource limits, the current usage and the credits of the account
+	AccountResources struct {
+		Credits float64
+		Limits  Resources
+		Usage   Resources
+	}
+)
+
+// GetAccountResources fetches the resource limits of the account and sums up the resources in use
+func (d *driver) GetAccountResources() (*AccountResources, error) {
+	account, err := d.svc.GetAccount()
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching account: %s", err)
+	}
+
+	result := &AccountResources{
+		Credits: account.Credits,
+		Limits: Resources{
+			Cores:      account.ResourceLimits.Cores,
+			Memory:     account.ResourceLimits.Memory,
+			PublicIPv4: account.ResourceLimits.PublicIPv4,
+			StorageSSD: account.ResourceLimits.StorageSSD,
+			StorageHDD: account.ResourceLimits.StorageHDD,
+		},
+	}
+
+	servers, err := d.svc.GetServers()
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching servers: %s", err)
+	}
+	for _, s := range servers.Servers {
+		result.Usage.Cores += s.CoreNumber
+		result.Usage.Memory += s.MemoryAmount
+	}
+
+	ipAddresses, err := d.svc.GetIPAddresses()
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching IP addresses: %s", err)
+	}
+	for _, ip := range ipAddresses.IPAddresses {
+		if ip.Access == upcloud.IPAddressAccessPublic && ip.Family == upcloud.IPAddressFamilyIPv4 {
+			result.Usage.PublicIPv4++
+		}
+	}
+
+	storages, err := d.svc.GetStorages(&request.GetStoragesRequest{
+		Access: upcloud.StorageAccessPrivate,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching storages: %s", err)
+	}
+	for _, s := range storages.Storages {
+		if s.Type != upcloud.StorageTypeNormal && s.Type != upcloud.StorageTypeTemplate {
+			continue
+		}
+		if s.Tier == upcloud.StorageTierHDD {
+			result.Usage.StorageHDD += s.Size
+		} else {
+			result.Usage.StorageSSD += s.Size
+		}
+	}
+	return result, nil
+}
+
+// EstimatePrice returns the hourly price of the build server, its storages and the templates in the price zone
+func EstimatePrice(zone *upcloud.PriceZone, required Resources, templateSize int) float64 {
+	price := func(p *upcloud.Price, amount int) float64 {
+		if p == nil || p.Amount == 0 {
+			return 0
+		}
+		return p.Price * float64(amount) / float64(p.Amount)
+	}
+
+	// every server uses the default plan, ServerPlan2xCPU2GB holds the price of the 1xCPU-2GB plan
+	total := price(zone.ServerPlan2xCPU2GB, required.Cores/DefaultPlanCores)
+	total += price(zone.IPv4Address, required.PublicIPv4)
+	total += price(zone.StorageMaxIOPS, required.StorageSSD-templateSize)
+	total += price(zone.StorageTemplate, templateSize)
+	return total
+}
+
+// CheckResources returns a description of every limit that would be exceeded by the required resources,
+// limits set to zero are not enforced
+func CheckResources(account *AccountResources, required Resources) []string {
+	problems := []string{}
+	check := func(name, unit string, limit, usage, need int) {
+		if limit > 0 && usage+need > limit {
+			problems = append(problems, fmt.Sprintf("%s: limit %d%s, in use %d%s, build needs %d%s", name, limit, unit, usage, unit, need, unit))
+		}
+	}
+	check("CPU cores", "", account.Limits.Cores, account.Usage.Cores, required.Cores)
+	check("Memory", " MB", account.Limits.Memory, account.Usage.Memory, required.Memory)
+	check("Public IPv4 addresses", "", account.Limits.PublicIPv4, account.Usage.PublicIPv4, required.PublicIPv4)
+	check("MaxIOPS storage", " GB", account.Limits.StorageSSD, account.Usage.StorageSSD, required.StorageSSD)
+	check("HDD storage", " GB", account.Limits.StorageHDD, account.Usage.StorageHDD, required.StorageHDD)
+	return problems
+}
@@ -0,0 +1,43 @@
+package upcloud
+
+import (
+	"math"
+	"testing"
+
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
+)
+
+func TestCheckResources(t *testing.T) {
+	account := &AccountResources{
+		Limits: Resources{Cores: 10, Memory: 8192, PublicIPv4: 2, StorageSSD: 100},
+		Usage:  Resources{Cores: 10, Memory: 4096, PublicIPv4: 1, StorageSSD: 50, StorageHDD: 500},
+	}
+	required := Resources{Cores: 1, Memory: 2048, PublicIPv4: 1, StorageSSD: 75}
+
+	problems := CheckResources(account, required)
+	if len(problems) != 2 {
+		t.Fatalf("Expected 2 problems, got %v", problems)
+	}
+	if problems[0] != "CPU cores: limit 10, in use 10, build needs 1" {
+		t.Errorf("Unexpected problem: %s", problems[0])
+	}
+	if problems[1] != "MaxIOPS storage: limit 100 GB, in use 50 GB, build needs 75 GB" {
+		t.Errorf("Unexpected problem: %s", problems[1])
+	}
+}
+
+func TestEstimatePrice(t *testing.T) {
+	zone := &upcloud.PriceZone{
+		ServerPlan2xCPU2GB: &upcloud.Price{Amount: 1, Price: 1.488},
+		IPv4Address:        &upcloud.Price{Amount: 1, Price: 0.336},
+		StorageMaxIOPS:     &upcloud.Price{Amount: 1, Price: 0.031},
+		StorageTemplate:    &upcloud.Price{Amount: 1, Price: 0.031},
+	}
+	required := Resources{Cores: 1, PublicIPv4: 1, StorageSSD: 75}
+
+	price := EstimatePrice(zone, required, 50)
+	expected := 1.488 + 0.336 + 25*0.031 + 50*0.031
+	if math.Abs(price-expected) > 0.0001 {
+		t.Errorf("Expected price %f, got %f", expected, price)
+	}
+}
@@ -0,0 +1,180 @@
+package upcloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud/request"
+)
+
+const (
+	LeftoverTypeServer  = "server"
+	LeftoverTypeStorage = "storage"
+
+	leftoverTitlePattern = `^packer-.+-(\d{8}-\d{6})`
+)
+
+var leftoverTitleRegexp = regexp.MustCompile(leftoverTitlePattern)
+
+type (
+	// Leftover is a server or a storage left behind by a failed or cancelled build
+	Leftover struct {
+		Type    string
+		UUID    string
+		Title   string
+		Zone    string
+		Created time.Time
+	}
+
+	// labelledResource holds the fields of servers and storages needed to recognise leftovers
+	labelledResource struct {
+		UUID   string     `json:"uuid"`
+		Title  string     `json:"title"`
+		Zone   string     `json:"zone"`
+		Type   string     `json:"type"`
+		Labels LabelSlice `json:"labels"`
+	}
+)
+
+func (r *labelledResource) label(key string) string {
+	for _, l := range r.Labels {
+		if l.Key == key {
+			return l.Value
+		}
+	}
+	return ""
+}
+
+// GetLeftovers lists servers and normal storages created by the builder which are older than the given age.
+// Servers kept with 'keep_server_on_failure' are only listed after their expiry time. Resources are recognised
+// by the builder label, matchTitle also includes unlabelled resources with a builder title.
+func (d *driver) GetLeftovers(olderThan time.Duration, matchTitle bool) ([]Leftover, error) {
+	serversResponse, err := d.client.PerformJSONGetRequest(d.client.CreateRequestURL("/server"))
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching servers: %s", parseServiceError(err))
+	}
+
+	servers := struct {
+		Servers struct {
+			Server []labelledResource `json:"server"`
+		} `json:"servers"`
+	}{}
+	if err := json.Unmarshal(serversResponse, &servers); err != nil {
+		return nil, err
+	}
+
+	storagesResponse, err := d.client.PerformJSONGetRequest(d.client.CreateRequestURL("/storage/private"))
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching storages: %s", parseServiceError(err))
+	}
+
+	storages := struct {
+		Storages struct {
+			Storage []labelledResource `json:"storage"`
+		} `json:"storages"`
+	}{}
+	if err := json.Unmarshal(storagesResponse, &storages); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	leftovers := findLeftovers(LeftoverTypeServer, servers.Servers.Server, olderThan, matchTitle, now)
+
+	// disks attached to a server are deleted together with it or are still in use
+	storageLeftovers, err := detachedLeftovers(findLeftovers(LeftoverTypeStorage, storages.Storages.Storage, olderThan, matchTitle, now), d.isStorageAttached)
+	if err != nil {
+		return nil, err
+	}
+	return append(leftovers, storageLeftovers...), nil
+}
+
+// detachedLeftovers filters out the storages attached to a server
+func detachedLeftovers(leftovers []Leftover, isAttached func(string) (bool, error)) ([]Leftover, error) {
+	detached := []Leftover{}
+	for _, l := range leftovers {
+		attached, err := isAttached(l.UUID)
+		if err != nil {
+			return nil, err
+		}
+		if !attached {
+			detached = append(detached, l)
+		}
+	}
+	return detached, nil
+}
+
+// isStorageAttached reports whether the storage is attached to a server, which the storage list doesn't tell
+func (d *driver) isStorageAttached(storageUuid string) (bool, error) {
+	details, err := d.svc.GetStorageDetails(&request.GetStorageDetailsRequest{
+		UUID: storageUuid,
+	})
+	if err != nil {
+		return false, fmt.Errorf("Error fetching storage %q: %s", storageUuid, err)
+	}
+	return len(details.ServerUUIDs) > 0, nil
+}
+
+// findLeftovers filters resources created by the builder which are old enough to be deleted.
+// The age is read from the creation time label. Resources created before the label was added
+// fall back to the title, which contains the local time of the build.
+func findLeftovers(resourceType string, resources []labelledResource, olderThan time.Duration, matchTitle bool, now time.Time) []Leftover {
+	leftovers := []Leftover{}
+	for _, r := range resources {
+		// templates are build results, only disks are left over
+		if resourceType == LeftoverTypeStorage && r.Type != upcloud.StorageTypeNormal {
+			continue
+		}
+
+		match := leftoverTitleRegexp.FindStringSubmatch(r.Title)
+		if r.label(LabelBuilder) != LabelBuilderValue && (!matchTitle || match == nil) {
+			continue
+		}
+
+		created := resourceCreated(&r, match)
+
+		if expiresAt := r.label(LabelExpiresAt); expiresAt != "" {
+			// servers kept on failure are swept only after they expire
+			t, err := time.Parse(time.RFC3339, expiresAt)
+			if err != nil || now.Before(t) {
+				continue
+			}
+		} else if olderThan > 0 && (created.IsZero() || now.Sub(created) < olderThan) {
+			// resources of unknown age are only included when no age limit is given
+			continue
+		}
+
+		leftovers = append(leftovers, Leftover{
+			Type:    resourceType,
+			UUID:    r.UUID,
+			Title:   r.Title,
+			Zone:    r.Zone,
+			Created: created,
+		})
+	}
+
+	sort.SliceStable(leftovers, func(i, j int) bool {
+		return leftovers[i].Created.Before(leftovers[j].Created)
+	})
+	return leftovers
+}
+
+// resourceCreated returns the creation time of the resource, or zero time if it is unknown
+func resourceCreated(r *labelledResource, titleMatch []string) time.Time {
+	if createdAt := r.label(LabelCreatedAt); createdAt != "" {
+		if t, err := time.Parse(time.RFC3339, createdAt); err == nil {
+			return t
+		}
+		return time.Time{}
+	}
+
+	if titleMatch != nil {
+		if t, err := time.ParseInLocation("20060102-150405", titleMatch[1], time.Local); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
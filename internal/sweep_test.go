@@ -0,0 +1,92 @@
+package upcloud
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
+)
+
+func TestFindLeftovers(t *testing.T) {
+	now := time.Date(2021, 2, 10, 12, 0, 0, 0, time.UTC)
+	builder := Label{Key: LabelBuilder, Value: LabelBuilderValue}
+	resources := []labelledResource{
+		{UUID: "old", Title: "packer-custom-image-20210206-213858", Labels: LabelSlice{builder, {Key: LabelCreatedAt, Value: "2021-02-06T21:38:58Z"}}},
+		{UUID: "new", Title: "packer-custom-image-20210210-113000", Labels: LabelSlice{builder, {Key: LabelCreatedAt, Value: "2021-02-10T11:30:00Z"}}},
+		{UUID: "other", Title: "web-server-1"},
+		{UUID: "unlabelled", Title: "packer-custom-image-20210201-000000"},
+		{UUID: "labelled", Title: "packer-app-1.2.3", Labels: LabelSlice{builder}},
+		{UUID: "invalid", Title: "packer-app-1.2.4", Labels: LabelSlice{builder, {Key: LabelCreatedAt, Value: "yesterday"}}},
+		{UUID: "kept", Title: "packer-custom-image-20210201-000000", Labels: LabelSlice{builder, {Key: LabelExpiresAt, Value: "2021-02-11T00:00:00Z"}}},
+		{UUID: "expired", Title: "packer-custom-image-20210210-110000", Labels: LabelSlice{builder, {Key: LabelExpiresAt, Value: "2021-02-10T00:00:00Z"}}},
+	}
+
+	leftovers := findLeftovers(LeftoverTypeServer, resources, 24*time.Hour, false, now)
+	if len(leftovers) != 2 || leftovers[0].UUID != "old" || leftovers[1].UUID != "expired" {
+		t.Errorf("Unexpected leftovers: %+v", leftovers)
+	}
+
+	leftovers = findLeftovers(LeftoverTypeServer, resources, 0, false, now)
+	if len(leftovers) != 5 {
+		t.Errorf("Unexpected leftovers without age limit: %+v", leftovers)
+	}
+	for _, l := range leftovers {
+		if l.UUID == "invalid" && !l.Created.IsZero() {
+			t.Errorf("Expected unknown creation time for invalid label, got: %s", l.Created)
+		}
+	}
+
+	leftovers = findLeftovers(LeftoverTypeServer, resources, 0, true, now)
+	if len(leftovers) != 6 {
+		t.Errorf("Unexpected leftovers with title matching: %+v", leftovers)
+	}
+}
+
+func TestFindLeftovers_storages(t *testing.T) {
+	now := time.Date(2021, 2, 10, 12, 0, 0, 0, time.Local)
+	resources := []labelledResource{
+		{UUID: "disk", Title: "packer-custom-image-20210206-213858-cloned-disk1", Type: upcloud.StorageTypeNormal},
+		{UUID: "template", Title: "packer-custom-image-20210206-213858", Type: upcloud.StorageTypeTemplate},
+	}
+
+	// resources created before the creation time label fall back to the title
+	leftovers := findLeftovers(LeftoverTypeStorage, resources, time.Hour, true, now)
+	if len(leftovers) != 1 || leftovers[0].UUID != "disk" {
+		t.Errorf("Unexpected leftovers: %+v", leftovers)
+	}
+}
+
+func TestDetachedLeftovers(t *testing.T) {
+	leftovers := []Leftover{
+		{UUID: "renamed-disk"},
+		{UUID: "second-disk"},
+		{UUID: "orphan"},
+	}
+	attached := map[string]bool{"renamed-disk": true, "second-disk": true}
+
+	detached, err := detachedLeftovers(leftovers, func(uuid string) (bool, error) {
+		return attached[uuid], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(detached) != 1 || detached[0].UUID != "orphan" {
+		t.Errorf("Expected only the detached storage, got: %+v", detached)
+	}
+}
+
+func TestLabelSlice_UnmarshalJSON(t *testing.T) {
+	for _, data := range []string{
+		`{"label":[{"key":"packer-builder","value":"upcloud"}]}`,
+		`[{"key":"packer-builder","value":"upcloud"}]`,
+	} {
+		var labels LabelSlice
+		if err := json.Unmarshal([]byte(data), &labels); err != nil {
+			t.Fatalf("Unexpected error for %s: %s", data, err)
+		}
+		if len(labels) != 1 || labels[0].Key != LabelBuilder || labels[0].Value != LabelBuilderValue {
+			t.Errorf("Unexpected labels for %s: %+v", data, labels)
+		}
+	}
+}
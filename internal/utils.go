@@ -2,6 +2,8 @@ package upcloud
 
 import (
 	"fmt"
+	"net"
+	"strings"
 	"time"
 
 	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
@@ -18,23 +20,99 @@ func StepHaltWithError(state multistep.StateBag, err error) multistep.StepAction
 	return multistep.ActionHalt
 }
 
-// parse public ip from server details
-func GetServerIp(details *upcloud.ServerDetails) (string, error) {
-	for _, ipAddress := range details.IPAddresses {
-		if ipAddress.Access == upcloud.IPAddressAccessPublic && ipAddress.Family == upcloud.IPAddressFamilyIPv4 {
-			return ipAddress.Address, nil
+const (
+	SSHInterfacePublicIPv4 = "public_ipv4"
+	SSHInterfacePublicIPv6 = "public_ipv6"
+	SSHInterfaceUtility    = "utility"
+	SSHInterfacePrivate    = "private"
+)
+
+// ServerAddress is an IP address of the server together with the interface it belongs to
+type ServerAddress struct {
+	Access  string
+	Family  string
+	Address string
+	Network string
+}
+
+// GetServerAddresses lists the IP addresses of every network interface of the server
+func GetServerAddresses(details *upcloud.ServerDetails) []ServerAddress {
+	addresses := []ServerAddress{}
+	for _, iface := range details.Networking.Interfaces {
+		for _, ip := range iface.IPAddresses {
+			if ip.Address == "" {
+				continue
+			}
+			addresses = append(addresses, ServerAddress{
+				Access:  iface.Type,
+				Family:  ip.Family,
+				Address: ip.Address,
+				Network: iface.Network,
+			})
+		}
+	}
+
+	// interfaces are not always included in the response
+	if len(addresses) == 0 {
+		for _, ip := range details.IPAddresses {
+			addresses = append(addresses, ServerAddress{
+				Access:  ip.Access,
+				Family:  ip.Family,
+				Address: ip.Address,
+			})
+		}
+	}
+	return addresses
+}
+
+// Matches tells whether the communicator connects to the address with the given 'ssh_interface',
+// network is only used with private interfaces
+func (a ServerAddress) Matches(sshInterface, network string) bool {
+	switch sshInterface {
+	case SSHInterfacePublicIPv4:
+		return a.Access == upcloud.IPAddressAccessPublic && a.Family == upcloud.IPAddressFamilyIPv4
+	case SSHInterfacePublicIPv6:
+		return a.Access == upcloud.IPAddressAccessPublic && a.Family == upcloud.IPAddressFamilyIPv6
+	case SSHInterfaceUtility:
+		return a.Access == upcloud.IPAddressAccessUtility
+	case SSHInterfacePrivate:
+		return a.Access == upcloud.IPAddressAccessPrivate && (network == "" || a.Network == network)
+	}
+	return false
+}
+
+// GetServerIp picks the address the communicator connects to
+func GetServerIp(addresses []ServerAddress, sshInterface, network string) (string, error) {
+	for _, a := range addresses {
+		if a.Matches(sshInterface, network) {
+			return a.Address, nil
 		}
 	}
-	return "", fmt.Errorf("Unable to find the public IPv4 address of the server")
+
+	if sshInterface == SSHInterfacePrivate && network != "" {
+		return "", fmt.Errorf("Unable to find the address of the server in private network %q", network)
+	}
+	return "", fmt.Errorf("Unable to find the %s address of the server", sshInterface)
 }
 
 func GetNowString() string {
 	return time.Now().Format("20060102-150405")
 }
 
-// SshHostCallback retrieves the public IPv4 address of the server
+// ZoneVariableName returns the name of a per-zone generated data variable,
+// e.g. "TemplateUUID_nl_ams1" for "TemplateUUID" and "nl-ams1"
+func ZoneVariableName(name, zone string) string {
+	return fmt.Sprintf("%s_%s", name, strings.ReplaceAll(zone, "-", "_"))
+}
+
+// SshHostCallback retrieves the address of the server selected with 'ssh_interface'.
+// The communicator appends ":<port>" to the host, so IPv6 addresses are bracketed
 func SshHostCallback(state multistep.StateBag) (string, error) {
-	return state.Get("server_ip").(string), nil
+	host := state.Get("server_ip").(string)
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		return fmt.Sprintf("[%s]", host), nil
+	}
+	return host, nil
 }
 
 // for config type convertion
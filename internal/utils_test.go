@@ -0,0 +1,69 @@
+package upcloud
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestGetServerIp(t *testing.T) {
+	addresses := GetServerAddresses(&upcloud.ServerDetails{
+		Networking: upcloud.ServerNetworking{
+			Interfaces: upcloud.ServerInterfaceSlice{
+				{Type: "public", IPAddresses: upcloud.IPAddressSlice{{Family: "IPv4", Address: "94.237.0.1"}, {Family: "IPv6", Address: "2a04:3540::1"}}},
+				{Type: "utility", IPAddresses: upcloud.IPAddressSlice{{Family: "IPv4", Address: "10.0.0.1"}}},
+				{Type: "private", Network: "net-1", IPAddresses: upcloud.IPAddressSlice{{Family: "IPv4", Address: "192.168.1.2"}}},
+				{Type: "private", Network: "net-2", IPAddresses: upcloud.IPAddressSlice{{Family: "IPv4", Address: "192.168.2.2"}}},
+			},
+		},
+	})
+
+	tests := []struct {
+		sshInterface string
+		network      string
+		expected     string
+	}{
+		{SSHInterfacePublicIPv4, "", "94.237.0.1"},
+		{SSHInterfacePublicIPv6, "", "2a04:3540::1"},
+		{SSHInterfaceUtility, "", "10.0.0.1"},
+		{SSHInterfacePrivate, "", "192.168.1.2"},
+		{SSHInterfacePrivate, "net-2", "192.168.2.2"},
+	}
+
+	for _, test := range tests {
+		ip, err := GetServerIp(addresses, test.sshInterface, test.network)
+		if err != nil {
+			t.Errorf("Unexpected error for %s %s: %s", test.sshInterface, test.network, err)
+		} else if ip != test.expected {
+			t.Errorf("Expected %q for %s %s, got %q", test.expected, test.sshInterface, test.network, ip)
+		}
+	}
+
+	if _, err := GetServerIp(addresses, SSHInterfacePrivate, "net-3"); err == nil {
+		t.Error("Expected an error for missing private network")
+	}
+}
+
+func TestSshHostCallback(t *testing.T) {
+	for _, ip := range []string{"94.237.0.1", "2a04:3540::1"} {
+		state := new(multistep.BasicStateBag)
+		state.Put("server_ip", ip)
+
+		host, err := SshHostCallback(state)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the address dialed by the connect step
+		address := fmt.Sprintf("%s:%d", host, 22)
+		dialHost, port, err := net.SplitHostPort(address)
+		if err != nil {
+			t.Errorf("Invalid dial address %q: %s", address, err)
+		} else if dialHost != ip || port != "22" {
+			t.Errorf("Expected %s port 22, got %s port %s", ip, dialHost, port)
+		}
+	}
+}
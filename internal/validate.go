@@ -0,0 +1,105 @@
+package upcloud
+
+import (
+	"fmt"
+
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud/request"
+)
+
+// OnlineValidationOpts holds the configuration values validated against the API
+type OnlineValidationOpts struct {
+	Zones       []string
+	Plan        string
+	StorageSize int
+	Storage     *StorageFilter
+	CDROM       string
+}
+
+// ValidateOnline checks the credentials and that the zones, the plan and the source storage exist
+func (d *driver) ValidateOnline(opts *OnlineValidationOpts) []error {
+	// credentials
+	if _, err := d.svc.GetAccount(); err != nil {
+		return []error{fmt.Errorf("Error validating credentials: %s", err)}
+	}
+
+	errs := []error{}
+
+	zones, err := d.svc.GetZones()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("Error fetching zones: %s", err))
+	} else {
+		errs = append(errs, checkZones(zones.Zones, opts.Zones)...)
+	}
+
+	plans, err := d.svc.GetPlans()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("Error fetching plans: %s", err))
+	} else if err := checkPlan(plans.Plans, opts.Plan); err != nil {
+		errs = append(errs, err)
+	}
+
+	storage, err := d.GetStorage(opts.Storage)
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		errs = append(errs, checkSourceStorage(storage, opts.StorageSize)...)
+	}
+
+	if opts.CDROM != "" {
+		details, err := d.svc.GetStorageDetails(&request.GetStorageDetailsRequest{UUID: opts.CDROM})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Error fetching CD-ROM storage %q: %s", opts.CDROM, err))
+		} else if err := checkCDROM(&details.Storage, opts.Zones[0]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func checkZones(available []upcloud.Zone, zones []string) []error {
+	known := map[string]bool{}
+	for _, z := range available {
+		known[z.ID] = true
+	}
+
+	errs := []error{}
+	for _, zone := range zones {
+		if !known[zone] {
+			errs = append(errs, fmt.Errorf("Zone %q does not exist", zone))
+		}
+	}
+	return errs
+}
+
+func checkPlan(available []upcloud.Plan, plan string) error {
+	for _, p := range available {
+		if p.Name == plan {
+			return nil
+		}
+	}
+	return fmt.Errorf("Plan %q does not exist", plan)
+}
+
+func checkSourceStorage(storage *upcloud.Storage, storageSize int) []error {
+	errs := []error{}
+	if err := ValidateSourceStorage(storage); err != nil {
+		errs = append(errs, err)
+	}
+
+	if storageSize < storage.Size {
+		errs = append(errs, fmt.Errorf("'storage_size' %d GB is smaller than the %d GB source storage %q",
+			storageSize, storage.Size, storage.UUID))
+	}
+	return errs
+}
+
+func checkCDROM(storage *upcloud.Storage, zone string) error {
+	if storage.Type != upcloud.StorageTypeCDROM {
+		return fmt.Errorf("Storage %q is of type %q, expected %q", storage.UUID, storage.Type, upcloud.StorageTypeCDROM)
+	}
+	if storage.Access == upcloud.StorageAccessPrivate && storage.Zone != zone {
+		return fmt.Errorf("Private CD-ROM storage %q is located in %q, expected %q", storage.UUID, storage.Zone, zone)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package upcloud
+
+import (
+	"testing"
+
+	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
+)
+
+func TestCheckZones(t *testing.T) {
+	available := []upcloud.Zone{{ID: "nl-ams1"}, {ID: "fi-hel1"}}
+
+	if errs := checkZones(available, []string{"nl-ams1", "fi-hel1"}); len(errs) != 0 {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+	if errs := checkZones(available, []string{"nl-ams1", "xx-foo1"}); len(errs) != 1 {
+		t.Errorf("Expected an error for unknown zone, got: %v", errs)
+	}
+}
+
+func TestCheckPlan(t *testing.T) {
+	available := []upcloud.Plan{{Name: "1xCPU-1GB"}, {Name: DefaultPlan}}
+
+	if err := checkPlan(available, DefaultPlan); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if err := checkPlan(available, "64xCPU-1GB"); err == nil {
+		t.Error("Expected an error for unknown plan")
+	}
+}
+
+func TestCheckSourceStorage(t *testing.T) {
+	storage := &upcloud.Storage{
+		UUID:  "uuid-1",
+		Type:  upcloud.StorageTypeTemplate,
+		State: upcloud.StorageStateOnline,
+		Size:  30,
+	}
+
+	if errs := checkSourceStorage(storage, 30); len(errs) != 0 {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+	if errs := checkSourceStorage(storage, 25); len(errs) != 1 {
+		t.Errorf("Expected an error for too small storage_size, got: %v", errs)
+	}
+
+	storage.Type = upcloud.StorageTypeCDROM
+	if errs := checkSourceStorage(storage, 30); len(errs) != 1 {
+		t.Errorf("Expected an error for cdrom storage, got: %v", errs)
+	}
+}
+
+func TestCheckCDROM(t *testing.T) {
+	storage := &upcloud.Storage{
+		UUID:   "uuid-1",
+		Type:   upcloud.StorageTypeCDROM,
+		Access: upcloud.StorageAccessPublic,
+		Zone:   "fi-hel1",
+	}
+
+	if err := checkCDROM(storage, "nl-ams1"); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	storage.Access = upcloud.StorageAccessPrivate
+	if err := checkCDROM(storage, "nl-ams1"); err == nil {
+		t.Error("Expected an error for private CD-ROM in another zone")
+	}
+
+	storage.Type = upcloud.StorageTypeTemplate
+	if err := checkCDROM(storage, "fi-hel1"); err == nil {
+		t.Error("Expected an error for template storage")
+	}
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"os"
+
 	upcloud "github.com/UpCloudLtd/upcloud-packer/builder/upcloud"
 
 	"github.com/hashicorp/packer-plugin-sdk/plugin"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "sweep" {
+		os.Exit(sweep(os.Args[2:], os.Stdout))
+	}
+
 	server, err := plugin.Server()
 	if err != nil {
 		panic(err)
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	upcloud "github.com/UpCloudLtd/upcloud-packer/builder/upcloud"
+	internal "github.com/UpCloudLtd/upcloud-packer/internal"
+)
+
+const sweepUsage = `Usage: %s sweep [options]
+
+  Finds servers and storages left behind by failed or cancelled builds and
+  optionally deletes them. API credentials are read from the UPCLOUD_API_USER
+  and UPCLOUD_API_PASSWORD environment variables.
+
+Options:
+`
+
+// sweep implements the 'sweep' subcommand and returns the exit status
+func sweep(args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("sweep", flag.ContinueOnError)
+	flags.SetOutput(out)
+	olderThan := flags.Duration("older-than", 24*time.Hour, "only include resources created longer than this ago, 0 includes resources of unknown age")
+	deleteResources := flags.Bool("delete", false, "delete the found resources instead of only listing them")
+	matchTitle := flags.Bool("match-title", false, "also include resources without the packer-builder label whose title matches the builder's title pattern")
+	timeout := flags.Duration("timeout", upcloud.DefaultTimeout, "amount of time to wait for servers to stop")
+	flags.Usage = func() {
+		fmt.Fprintf(out, sweepUsage, os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	username := os.Getenv("UPCLOUD_API_USER")
+	password := os.Getenv("UPCLOUD_API_PASSWORD")
+	if username == "" || password == "" {
+		fmt.Fprintln(out, "UPCLOUD_API_USER and UPCLOUD_API_PASSWORD must be set")
+		return 1
+	}
+
+	driver := internal.NewDriver(&internal.DriverConfig{
+		Username: username,
+		Password: password,
+		Timeout:  *timeout,
+	})
+
+	leftovers, err := driver.GetLeftovers(*olderThan, *matchTitle)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+
+	if len(leftovers) == 0 {
+		fmt.Fprintln(out, "No leftover resources found")
+		return 0
+	}
+
+	status := 0
+	for _, l := range leftovers {
+		created := "unknown"
+		if !l.Created.IsZero() {
+			created = l.Created.Format(time.RFC3339)
+		}
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\tcreated %s\n", l.Type, l.UUID, l.Zone, l.Title, created)
+
+		if !*deleteResources {
+			continue
+		}
+
+		if err := deleteLeftover(driver, l); err != nil {
+			fmt.Fprintf(out, "Error deleting %s %q: %s\n", l.Type, l.UUID, err)
+			status = 1
+			continue
+		}
+		fmt.Fprintf(out, "Deleted %s %q\n", l.Type, l.UUID)
+	}
+
+	if !*deleteResources {
+		fmt.Fprintln(out, "Dry run, use -delete to delete the listed resources")
+	}
+	return status
+}
+
+func deleteLeftover(driver internal.Driver, l internal.Leftover) error {
+	if l.Type == internal.LeftoverTypeStorage {
+		return driver.DeleteTemplate(l.UUID)
+	}
+
+	if err := driver.StopServer(l.UUID); err != nil {
+		return err
+	}
+	// the CD-ROM may hold a private ISO which must survive the server
+	if err := driver.DetachCDROM(l.UUID); err != nil {
+		return err
+	}
+	return driver.DeleteServer(l.UUID)
+}